@@ -2,14 +2,73 @@ package artifactservice
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/flowshot-io/polystore/pkg/types"
 	"github.com/flowshot-io/x/pkg/artifact"
 )
 
+const (
+	// tempSuffix marks an object as an in-progress upload which readers must ignore.
+	tempSuffix = ".tmp-"
+	// blobSuffix marks an object as an uploaded blob referenced by a commit marker.
+	blobSuffix = ".blob-"
+	// commitSuffix marks the commit marker of an artifact.
+	commitSuffix = ".commit"
+	// uploadIDLength is the number of random bytes in an upload id.
+	uploadIDLength = 8
+	// artifactExtension ends the name of every artifact.
+	artifactExtension = ".tar.gz"
+)
+
+var (
+	// ErrNotCommitted is returned when an artifact exists in storage but has no valid commit.
+	ErrNotCommitted = errors.New("artifact is not committed")
+	// ErrConflict is matched by errors returned when a conditional upload loses a race.
+	ErrConflict = errors.New("artifact was modified concurrently")
+)
+
+// ConflictError is returned by UploadArtifactIfMatch when the stored artifact does not
+// have the expected digest.
+type ConflictError struct {
+	Name           string
+	ExpectedDigest string
+	ActualDigest   string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("artifact %s has digest %q, expected %q", e.Name, e.ActualDigest, e.ExpectedDigest)
+}
+
+// Is reports whether the target is ErrConflict.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// CommitMode defines how an uploaded artifact is made visible to readers.
+type CommitMode int
+
+const (
+	// CommitMove writes the artifact to a temporary key and moves it into place once
+	// the write has completed. It relies on the storage backend providing an atomic move.
+	CommitMove CommitMode = iota
+	// CommitMarker writes the artifact to a unique key and then writes a small commit
+	// marker pointing at it. Readers only follow the marker, so backends without an
+	// atomic move never expose a partially written artifact.
+	CommitMarker
+)
+
 // ArtifactServiceClient represents the methods required for artifact management.
 type ArtifactServiceClient interface {
 	UploadArtifact(ctx context.Context, artifact artifact.Artifact) error
@@ -17,16 +76,44 @@ type ArtifactServiceClient interface {
 	DeleteArtifact(ctx context.Context, artifactName string) error
 }
 
+// ConditionalUploader is implemented by clients supporting optimistic concurrency control,
+// such as Client and ReplicatedClient.
+type ConditionalUploader interface {
+	// ArtifactDigest returns the digest of the committed artifact, or an empty string if it does not exist.
+	// Any other storage error is returned, so an outage is never mistaken for a missing artifact.
+	ArtifactDigest(ctx context.Context, artifactName string) (string, error)
+	// UploadArtifactIfMatch uploads an artifact only if the committed artifact still has the
+	// previous digest (an empty digest requires that it does not exist yet) and returns the new digest.
+	UploadArtifactIfMatch(ctx context.Context, artifact artifact.Artifact, previousDigest string) (string, error)
+}
+
 // Options holds the configuration for the artifact service.
+// WorkingDir sets the directory artifacts are stored in (defaults to the root of the store).
+// LeaseOwner enables leases on conditional uploads, identifying this client as the lease holder.
+// LeaseTTL sets how long a lease is held before it expires (defaults to DefaultLeaseTTL).
+// Metrics records operation statistics (defaults to NoOpMetrics).
+// CacheSize sets the maximum number of bytes of downloaded artifacts kept in memory (0 disables caching).
+// Caching requires CommitMarker, where every upload has a unique blob path; it is ignored with CommitMove.
 type Options struct {
 	Store      types.Storage
 	WorkingDir string
+	CommitMode CommitMode
+	LeaseOwner string
+	LeaseTTL   time.Duration
+	Metrics    Metrics
+	CacheSize  int64
 }
 
 // Client implements the ArtifactServiceClient interface.
 type Client struct {
 	store      types.Storage
 	workingDir string
+	commitMode CommitMode
+	locker     *Locker
+	leaseOwner string
+	leaseTTL   time.Duration
+	metrics    Metrics
+	cache      *blobCache
 }
 
 // New returns a new instance of an ArtifactServiceClient.
@@ -35,39 +122,65 @@ func New(opts Options) (ArtifactServiceClient, error) {
 		return nil, fmt.Errorf("store is required")
 	}
 
-	if opts.WorkingDir == "" {
-		opts.WorkingDir = "artifacts"
+	if opts.CommitMode != CommitMove && opts.CommitMode != CommitMarker {
+		return nil, fmt.Errorf("unknown commit mode: %d", opts.CommitMode)
+	}
+
+	if opts.Metrics == nil {
+		opts.Metrics = NoOpMetrics()
+	}
+
+	// With CommitMove a key is overwritten in place and the modification time reported by
+	// object stores is too coarse to tell uploads apart, so a cached copy could be stale.
+	var cache *blobCache
+	if opts.CacheSize > 0 && opts.CommitMode == CommitMarker {
+		cache = newBlobCache(opts.CacheSize)
 	}
 
 	return &Client{
-		store: opts.Store,
+		store:      opts.Store,
+		workingDir: opts.WorkingDir,
+		commitMode: opts.CommitMode,
+		locker:     NewLocker(opts.Store, ""),
+		leaseOwner: opts.LeaseOwner,
+		leaseTTL:   opts.LeaseTTL,
+		metrics:    opts.Metrics,
+		cache:      cache,
 	}, nil
 }
 
 // UploadArtifact uploads an artifact to storage.
-func (c *Client) UploadArtifact(ctx context.Context, artifact artifact.Artifact) error {
+// The artifact only becomes visible to DownloadArtifact once the upload has been committed.
+func (c *Client) UploadArtifact(ctx context.Context, artifact artifact.Artifact) (err error) {
+	defer c.observe(OperationUpload, time.Now(), &err)
+
 	var buf bytes.Buffer
 	if err := artifact.SaveToWriter(&buf); err != nil {
 		return err
 	}
 
-	if _, err := c.store.WriteWithContext(ctx, c.getWorkingPath(artifact.GetName()), bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+	if err := c.writeBlob(ctx, artifact.GetName(), buf.Bytes(), nil); err != nil {
 		return err
 	}
 
+	recordUpload(c.metrics, buf.Bytes())
 	return nil
 }
 
 // DownloadArtifact downloads an artifact from storage.
-func (c *Client) DownloadArtifact(ctx context.Context, artifactName string) (artifact.Artifact, error) {
-	artifact := artifact.New(artifactName)
-	path := c.getWorkingPath(artifact.GetName())
+// Artifacts whose upload has not been committed are reported as not found.
+func (c *Client) DownloadArtifact(ctx context.Context, artifactName string) (_ artifact.Artifact, err error) {
+	defer c.observe(OperationDownload, time.Now(), &err)
 
-	if _, err := c.store.StatWithContext(ctx, path); err != nil {
-		return nil, err
-	}
+	return c.downloadArtifact(ctx, artifactName)
+}
 
-	reader, err := c.store.ReadWithContext(ctx, path, 0, 0)
+// downloadArtifact downloads an artifact without recording the operation, leaving that to
+// the caller.
+func (c *Client) downloadArtifact(ctx context.Context, artifactName string) (artifact.Artifact, error) {
+	artifact := artifact.New(artifactName)
+
+	reader, err := c.openBlob(ctx, artifact.GetName())
 	if err != nil {
 		return nil, err
 	}
@@ -80,15 +193,411 @@ func (c *Client) DownloadArtifact(ctx context.Context, artifactName string) (art
 	return artifact, nil
 }
 
+// ArtifactDigest returns the hex encoded SHA-256 digest of the committed artifact.
+// It returns an empty string if the artifact has not been committed, and the error of the
+// storage if it cannot tell.
+// Digest reads are not downloads and are kept out of the transfer and cache metrics.
+func (c *Client) ArtifactDigest(ctx context.Context, artifactName string) (string, error) {
+	path, err := c.resolveBlob(ctx, artifact.New(artifactName).GetName())
+	if isNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if c.cache != nil {
+		if data, ok := c.cache.get(path); ok {
+			digest := sha256.Sum256(data)
+			return hex.EncodeToString(digest[:]), nil
+		}
+	}
+
+	reader, err := c.store.ReadWithContext(ctx, path, 0, 0)
+	if isNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// UploadArtifactIfMatch uploads an artifact only if the committed artifact still has the
+// previous digest, returning a *ConflictError otherwise. When a lease owner is configured
+// the check and upload run while holding the artifact's lease, so a competing writer
+// fails with a *LeaseHeldError instead of racing. The lease is renewed right before the
+// upload is committed; if it was lost in the meantime, e.g. because the upload took longer
+// than the lease TTL, nothing is committed and an error matching ErrLeaseLost is returned.
+func (c *Client) UploadArtifactIfMatch(ctx context.Context, artifact artifact.Artifact, previousDigest string) (_ string, err error) {
+	defer c.observe(OperationUpload, time.Now(), &err)
+
+	var buf bytes.Buffer
+	if err := artifact.SaveToWriter(&buf); err != nil {
+		return "", err
+	}
+
+	digest, err := c.writeBlobIfMatch(ctx, artifact.GetName(), buf.Bytes(), previousDigest)
+	if err != nil {
+		return "", err
+	}
+
+	recordUpload(c.metrics, buf.Bytes())
+	return digest, nil
+}
+
 // DeleteArtifact deletes an artifact from storage.
-func (c *Client) DeleteArtifact(ctx context.Context, artifactName string) error {
-	if err := c.store.DeleteWithContext(ctx, c.getWorkingPath(artifactName)); err != nil {
+func (c *Client) DeleteArtifact(ctx context.Context, artifactName string) (err error) {
+	defer c.observe(OperationDelete, time.Now(), &err)
+
+	return c.deleteArtifact(ctx, artifactName)
+}
+
+// deleteArtifact deletes an artifact without recording the operation, leaving that to the
+// caller.
+func (c *Client) deleteArtifact(ctx context.Context, artifactName string) error {
+	name := artifact.New(artifactName).GetName()
+
+	if c.commitMode == CommitMarker {
+		blobPath, err := c.readCommit(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		// Remove the marker first so readers stop seeing the artifact before its blob disappears.
+		if err := c.store.DeleteWithContext(ctx, c.getCommitPath(name)); err != nil {
+			return err
+		}
+
+		return c.store.DeleteWithContext(ctx, blobPath)
+	}
+
+	if err := c.store.DeleteWithContext(ctx, c.getWorkingPath(name)); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// writeBlob stores the serialized artifact and commits it according to the commit mode.
+// If beforeCommit is set, it is called once the data is stored and the commit is abandoned
+// if it fails.
+func (c *Client) writeBlob(ctx context.Context, name string, data []byte, beforeCommit func(ctx context.Context) error) error {
+	id, err := newUploadID()
+	if err != nil {
+		return err
+	}
+
+	if c.commitMode == CommitMarker {
+		return c.writeBlobWithMarker(ctx, name, id, data, beforeCommit)
+	}
+
+	tempPath := c.getWorkingPath(name) + tempSuffix + id
+	if _, err := c.store.WriteWithContext(ctx, tempPath, bytes.NewReader(data), int64(len(data))); err != nil {
+		c.store.DeleteWithContext(ctx, tempPath)
+		return err
+	}
+
+	if beforeCommit != nil {
+		if err := beforeCommit(ctx); err != nil {
+			c.store.DeleteWithContext(ctx, tempPath)
+			return fmt.Errorf("error committing artifact %s: %w", name, err)
+		}
+	}
+
+	if err := c.store.MoveWithContext(ctx, tempPath, c.getWorkingPath(name)); err != nil {
+		c.store.DeleteWithContext(ctx, tempPath)
+		return fmt.Errorf("error committing artifact %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (c *Client) writeBlobWithMarker(ctx context.Context, name string, id string, data []byte, beforeCommit func(ctx context.Context) error) error {
+	blobPath := c.getWorkingPath(name) + blobSuffix + id
+	if _, err := c.store.WriteWithContext(ctx, blobPath, bytes.NewReader(data), int64(len(data))); err != nil {
+		c.store.DeleteWithContext(ctx, blobPath)
+		return err
+	}
+
+	if beforeCommit != nil {
+		if err := beforeCommit(ctx); err != nil {
+			c.store.DeleteWithContext(ctx, blobPath)
+			return fmt.Errorf("error committing artifact %s: %w", name, err)
+		}
+	}
+
+	// A missing or incomplete marker simply means there is no previous blob to clean up.
+	previous, _ := c.readCommit(ctx, name)
+
+	marker := []byte(blobPath)
+	if _, err := c.store.WriteWithContext(ctx, c.getCommitPath(name), bytes.NewReader(marker), int64(len(marker))); err != nil {
+		c.store.DeleteWithContext(ctx, blobPath)
+		return fmt.Errorf("error committing artifact %s: %w", name, err)
+	}
+
+	// The previous blob is no longer referenced; failing to remove it only leaks storage.
+	if previous != "" && previous != blobPath {
+		c.store.DeleteWithContext(ctx, previous)
+	}
+
+	return nil
+}
+
+// writeBlobIfMatch stores the serialized artifact if the committed blob still has the previous digest.
+func (c *Client) writeBlobIfMatch(ctx context.Context, name string, data []byte, previousDigest string) (_ string, err error) {
+	var beforeCommit func(ctx context.Context) error
+	if c.leaseOwner != "" {
+		lease, acquireErr := c.locker.Acquire(ctx, c.getWorkingPath(name), c.leaseOwner, c.leaseTTL)
+		if acquireErr != nil {
+			return "", acquireErr
+		}
+
+		defer func() {
+			// A lease lost after the commit was confirmed only means it expired early.
+			if releaseErr := lease.Release(ctx); releaseErr != nil && !errors.Is(releaseErr, ErrLeaseLost) && err == nil {
+				err = fmt.Errorf("error releasing lease of artifact %s: %w", name, releaseErr)
+			}
+		}()
+
+		// Another writer may have taken over an expired lease while the data was stored.
+		beforeCommit = lease.Renew
+	}
+
+	current, err := c.ArtifactDigest(ctx, name)
+	if err != nil {
+		return "", err
+	}
+
+	if current != previousDigest {
+		return "", &ConflictError{Name: name, ExpectedDigest: previousDigest, ActualDigest: current}
+	}
+
+	if err := c.writeBlob(ctx, name, data, beforeCommit); err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// readBlob returns the content of the committed blob of an artifact.
+func (c *Client) readBlob(ctx context.Context, name string) ([]byte, error) {
+	reader, err := c.openBlob(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// openBlob opens the committed blob of an artifact for reading. With a cache the blob is
+// buffered and served from memory when it has been read before; otherwise it is streamed
+// from storage.
+func (c *Client) openBlob(ctx context.Context, name string) (io.ReadCloser, error) {
+	path, err := c.resolveBlob(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.cache != nil {
+		data, ok := c.cache.get(path)
+		c.metrics.ObserveCacheLookup(ok)
+		if ok {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+
+	reader, err := c.store.ReadWithContext(ctx, path, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.cache == nil {
+		return &countingReader{ReadCloser: reader, metrics: c.metrics}, nil
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	c.metrics.AddBytes(OperationDownload, int64(len(data)))
+	c.cache.put(path, data)
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// countingReader records the bytes read from a streamed download.
+type countingReader struct {
+	io.ReadCloser
+	metrics Metrics
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.metrics.AddBytes(OperationDownload, int64(n))
+	}
+	return n, err
+}
+
+// listArtifacts returns the names of all committed artifacts in the working directory.
+func (c *Client) listArtifacts(ctx context.Context) ([]string, error) {
+	prefix := ""
+	if c.workingDir != "" {
+		prefix = c.workingDir + "/"
+	}
+
+	objects, err := c.store.ListWithContext(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, object := range *objects {
+		name := strings.TrimPrefix(object.Path, prefix)
+		if isScopePath(name) {
+			continue
+		}
+
+		if c.commitMode == CommitMarker {
+			if strings.HasSuffix(name, commitSuffix) {
+				names = append(names, strings.TrimSuffix(name, commitSuffix))
+			}
+			continue
+		}
+
+		// Without a working directory unrelated objects may share the bucket.
+		if !isInternalPath(name) && strings.HasSuffix(name, artifactExtension) {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// resolveBlob returns the storage path of the committed blob of an artifact. With commit
+// markers every upload has a unique path, which also serves as its cache key.
+func (c *Client) resolveBlob(ctx context.Context, name string) (string, error) {
+	if c.commitMode == CommitMarker {
+		return c.readCommit(ctx, name)
+	}
+
+	return c.getWorkingPath(name), nil
+}
+
+// readCommit returns the blob path referenced by the commit marker of an artifact.
+func (c *Client) readCommit(ctx context.Context, name string) (string, error) {
+	commitPath := c.getCommitPath(name)
+	if _, err := c.store.StatWithContext(ctx, commitPath); err != nil {
+		return "", err
+	}
+
+	reader, err := c.store.ReadWithContext(ctx, commitPath, 0, 0)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	// A marker that does not reference a blob of this artifact was not written completely.
+	blobPath := string(content)
+	prefix := c.getWorkingPath(name) + blobSuffix
+	if !strings.HasPrefix(blobPath, prefix) || len(blobPath) != len(prefix)+uploadIDLength*2 {
+		return "", fmt.Errorf("%w: %s", ErrNotCommitted, name)
+	}
+
+	return blobPath, nil
+}
+
 func (c *Client) getWorkingPath(artifactName string) string {
 	return filepath.Join(c.workingDir, artifactName)
 }
+
+func (c *Client) getCommitPath(artifactName string) string {
+	return c.getWorkingPath(artifactName) + commitSuffix
+}
+
+// observe records the duration and outcome of an operation started at start.
+func (c *Client) observe(op Operation, start time.Time, err *error) {
+	c.metrics.ObserveOperation(op, time.Since(start), *err)
+}
+
+// recordUpload records the size and compression ratio of an uploaded blob. The ratio is
+// skipped with NoOpMetrics, since computing it decompresses the whole blob.
+func recordUpload(metrics Metrics, data []byte) {
+	metrics.AddBytes(OperationUpload, int64(len(data)))
+
+	if _, ok := metrics.(noOpMetrics); ok {
+		return
+	}
+
+	if ratio, err := compressionRatio(data); err == nil {
+		metrics.ObserveCompressionRatio(ratio)
+	}
+}
+
+// compressionRatio returns the ratio of uncompressed to compressed size of a gzip blob.
+func compressionRatio(data []byte) (float64, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("empty blob")
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	n, err := io.Copy(io.Discard, reader)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(n) / float64(len(data)), nil
+}
+
+// isInternalPath reports whether a storage path holds bookkeeping of an artifact, such as
+// an in-progress upload, a commit marker or a lock, rather than an artifact itself.
+func isInternalPath(path string) bool {
+	return strings.Contains(path, tempSuffix) || strings.Contains(path, blobSuffix) ||
+		strings.HasSuffix(path, commitSuffix) || strings.HasSuffix(path, lockSuffix)
+}
+
+// isNotExist reports whether an error returned by storage means the object does not exist.
+// Storage backends do not share a not-found error, so well known messages are matched too.
+func isNotExist(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, ErrNotCommitted) {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "no such key") || strings.Contains(msg, "nosuchkey") || strings.Contains(msg, "not found")
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, uploadIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating upload id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,789 @@
+package artifactservice_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/artifact"
+	"github.com/flowshot-io/x/pkg/artifactservice"
+	"github.com/flowshot-io/x/pkg/artifactservice/artifactservicetest"
+	"github.com/flowshot-io/x/pkg/logger"
+)
+
+func newTestArtifact(t *testing.T, name string, content string) artifact.Artifact {
+	t.Helper()
+
+	a := artifact.New(name)
+	if err := a.AddFile("", "file.txt", []byte(content)); err != nil {
+		t.Fatalf("Failed to add file: %v", err)
+	}
+
+	return a
+}
+
+func conditional(t *testing.T, client artifactservice.ArtifactServiceClient) artifactservice.ConditionalUploader {
+	t.Helper()
+
+	uploader, ok := client.(artifactservice.ConditionalUploader)
+	if !ok {
+		t.Fatalf("Expected %T to implement ConditionalUploader", client)
+	}
+
+	return uploader
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	for _, mode := range []artifactservice.CommitMode{artifactservice.CommitMove, artifactservice.CommitMarker} {
+		t.Run(fmt.Sprintf("mode %d", mode), func(t *testing.T) {
+			ctx := context.Background()
+			store := artifactservicetest.NewStorage()
+			client, err := artifactservice.New(artifactservice.Options{Store: store, CommitMode: mode})
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+
+			for _, content := range []string{"first", "second"} {
+				if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", content)); err != nil {
+					t.Fatalf("Failed to upload artifact: %v", err)
+				}
+			}
+
+			downloaded, err := client.DownloadArtifact(ctx, "test")
+			if err != nil {
+				t.Fatalf("Failed to download artifact: %v", err)
+			}
+
+			files, err := downloaded.ListFiles()
+			if err != nil || len(files) != 1 {
+				t.Fatalf("Expected one file, got %v (err: %v)", files, err)
+			}
+
+			if err := client.DeleteArtifact(ctx, "test"); err != nil {
+				t.Fatalf("Failed to delete artifact: %v", err)
+			}
+
+			if paths := store.Paths(); len(paths) != 0 {
+				t.Errorf("Expected storage to be empty after delete, got %v", paths)
+			}
+		})
+	}
+}
+
+func TestInterruptedUploadIsNotVisible(t *testing.T) {
+	for _, mode := range []artifactservice.CommitMode{artifactservice.CommitMove, artifactservice.CommitMarker} {
+		t.Run(fmt.Sprintf("mode %d", mode), func(t *testing.T) {
+			ctx := context.Background()
+			store := artifactservicetest.NewStorage()
+			store.FailWrites(func(path string) bool { return true })
+
+			client, err := artifactservice.New(artifactservice.Options{Store: store, CommitMode: mode})
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+
+			if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", "content")); err == nil {
+				t.Fatalf("Expected upload to fail")
+			}
+
+			if _, err := client.DownloadArtifact(ctx, "test"); err == nil {
+				t.Errorf("Expected download of an uncommitted artifact to fail")
+			}
+		})
+	}
+}
+
+func TestInterruptedMarkerKeepsPreviousVersion(t *testing.T) {
+	ctx := context.Background()
+	store := artifactservicetest.NewStorage()
+	client, err := artifactservice.New(artifactservice.Options{Store: store, CommitMode: artifactservice.CommitMarker})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", "first")); err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	store.FailWrites(func(path string) bool { return strings.Contains(path, ".blob-") })
+	if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", "second")); err == nil {
+		t.Fatalf("Expected upload to fail")
+	}
+
+	if _, err := client.DownloadArtifact(ctx, "test"); err != nil {
+		t.Errorf("Expected the previously committed artifact to remain readable: %v", err)
+	}
+}
+
+func TestUploadArtifactIfMatch(t *testing.T) {
+	ctx := context.Background()
+	client, err := artifactservice.New(artifactservice.Options{Store: artifactservicetest.NewStorage(), LeaseOwner: "worker-1"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	digest, err := conditional(t, client).UploadArtifactIfMatch(ctx, newTestArtifact(t, "test", "first"), "")
+	if err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	stored, err := conditional(t, client).ArtifactDigest(ctx, "test")
+	if err != nil || stored != digest {
+		t.Fatalf("Expected stored digest %q, got %q (err: %v)", digest, stored, err)
+	}
+
+	if _, err := conditional(t, client).UploadArtifactIfMatch(ctx, newTestArtifact(t, "test", "second"), ""); !errors.Is(err, artifactservice.ErrConflict) {
+		t.Errorf("Expected a conflict when the artifact already exists, got %v", err)
+	}
+
+	var conflict *artifactservice.ConflictError
+	_, err = conditional(t, client).UploadArtifactIfMatch(ctx, newTestArtifact(t, "test", "second"), "stale")
+	if !errors.As(err, &conflict) || conflict.ActualDigest != digest {
+		t.Errorf("Expected a ConflictError reporting the current digest, got %v", err)
+	}
+
+	if _, err := conditional(t, client).UploadArtifactIfMatch(ctx, newTestArtifact(t, "test", "second"), digest); err != nil {
+		t.Errorf("Expected upload with the current digest to succeed, got %v", err)
+	}
+}
+
+func TestLeaseLostBeforeCommit(t *testing.T) {
+	for _, mode := range []artifactservice.CommitMode{artifactservice.CommitMove, artifactservice.CommitMarker} {
+		t.Run(fmt.Sprintf("mode %d", mode), func(t *testing.T) {
+			ctx := context.Background()
+			store := artifactservicetest.NewStorage()
+			client, err := artifactservice.New(artifactservice.Options{
+				Store:      store,
+				WorkingDir: "artifacts",
+				CommitMode: mode,
+				LeaseOwner: "worker-1",
+				LeaseTTL:   time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create client: %v", err)
+			}
+
+			// Let the lease expire and be taken over while the data is being stored.
+			store.OnWrite(func(path string) {
+				name, _, found := strings.Cut(path, ".tmp-")
+				if !found {
+					if name, _, found = strings.Cut(path, ".blob-"); !found {
+						return
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				if _, err := artifactservice.NewLocker(store, "").Acquire(ctx, name, "worker-2", time.Minute); err != nil {
+					t.Errorf("Failed to take over the lease: %v", err)
+				}
+			})
+
+			_, err = conditional(t, client).UploadArtifactIfMatch(ctx, newTestArtifact(t, "test", "first"), "")
+			if !errors.Is(err, artifactservice.ErrLeaseLost) {
+				t.Fatalf("Expected ErrLeaseLost, got %v", err)
+			}
+
+			store.OnWrite(nil)
+
+			if digest, err := conditional(t, client).ArtifactDigest(ctx, "test"); err != nil || digest != "" {
+				t.Errorf("Expected nothing to be committed, got digest %q (err: %v)", digest, err)
+			}
+
+			for _, path := range store.Paths() {
+				if strings.Contains(path, ".tmp-") || strings.Contains(path, ".blob-") {
+					t.Errorf("Expected the uncommitted upload to be removed, found %s", path)
+				}
+			}
+		})
+	}
+}
+
+func TestStorageOutage(t *testing.T) {
+	ctx := context.Background()
+	store := artifactservicetest.NewStorage()
+	client, err := artifactservice.New(artifactservice.Options{Store: store})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", "first")); err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	digest, err := conditional(t, client).ArtifactDigest(ctx, "test")
+	if err != nil {
+		t.Fatalf("Failed to get digest: %v", err)
+	}
+
+	locker := artifactservice.NewLocker(store, "locks")
+	lease, err := locker.Acquire(ctx, "resource", "owner-1", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to acquire lease: %v", err)
+	}
+
+	store.FailReads(true)
+
+	if current, err := conditional(t, client).ArtifactDigest(ctx, "test"); err == nil {
+		t.Errorf("Expected the outage to be reported, got digest %q", current)
+	}
+
+	if _, err := conditional(t, client).UploadArtifactIfMatch(ctx, newTestArtifact(t, "test", "second"), ""); err == nil {
+		t.Errorf("Expected a conditional upload to fail during the outage")
+	}
+
+	if _, err := locker.Acquire(ctx, "resource", "owner-2", time.Minute); err == nil {
+		t.Errorf("Expected acquiring a lease to fail during the outage")
+	}
+
+	store.FailReads(false)
+
+	if current, err := conditional(t, client).ArtifactDigest(ctx, "test"); err != nil || current != digest {
+		t.Errorf("Expected the artifact to be left unchanged, got digest %q (err: %v)", current, err)
+	}
+
+	if err := lease.Renew(ctx); err != nil {
+		t.Errorf("Expected the lease to still be held, got %v", err)
+	}
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	locker := artifactservice.NewLocker(artifactservicetest.NewStorage(), "locks")
+
+	lease, err := locker.Acquire(ctx, "resource", "owner-1", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to acquire lease: %v", err)
+	}
+
+	if _, err := locker.Acquire(ctx, "resource", "owner-2", time.Minute); !errors.Is(err, artifactservice.ErrLeaseHeld) {
+		t.Fatalf("Expected lease to be held, got %v", err)
+	}
+
+	// Concurrent calls sharing an owner name must not share the lease.
+	if _, err := locker.Acquire(ctx, "resource", "owner-1", time.Minute); !errors.Is(err, artifactservice.ErrLeaseHeld) {
+		t.Fatalf("Expected lease to be held against the same owner, got %v", err)
+	}
+
+	if err := lease.Renew(ctx); err != nil {
+		t.Fatalf("Failed to renew lease: %v", err)
+	}
+
+	if err := lease.Release(ctx); err != nil {
+		t.Fatalf("Failed to release lease: %v", err)
+	}
+
+	if _, err := locker.Acquire(ctx, "resource", "owner-2", time.Millisecond); err != nil {
+		t.Fatalf("Expected released lease to be acquirable, got %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := locker.Acquire(ctx, "resource", "owner-1", time.Minute); err != nil {
+		t.Fatalf("Expected expired lease to be taken over, got %v", err)
+	}
+
+	if err := lease.Renew(ctx); !errors.Is(err, artifactservice.ErrLeaseLost) {
+		t.Errorf("Expected renewing a released lease to fail with ErrLeaseLost, got %v", err)
+	}
+}
+
+func TestReplicatedClient(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := artifactservicetest.NewStorage(), artifactservicetest.NewStorage()
+
+	client, err := artifactservice.NewReplicated(artifactservice.ReplicatedOptions{
+		Primary:     artifactservice.Replica{Name: "primary", Store: primary},
+		Secondaries: []artifactservice.Replica{{Name: "secondary", Store: secondary}},
+		Mode:        artifactservice.ReplicateSync,
+		ReadOrder:   []string{"secondary"},
+		Logger:      logger.NoOp(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", "content")); err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	if len(secondary.Paths()) != 1 {
+		t.Fatalf("Expected artifact to be replicated, got %v", secondary.Paths())
+	}
+
+	// Reads fall back to the primary, which the read order leaves out, when the nearest
+	// replica lost the artifact.
+	secondary.Clear()
+	if _, err := client.DownloadArtifact(ctx, "test"); err != nil {
+		t.Fatalf("Expected download to fall back to the primary, got %v", err)
+	}
+
+	report, err := client.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+
+	if report.Checked != 1 || len(report.Repaired["secondary"]) != 1 {
+		t.Errorf("Expected one repaired artifact, got %+v", report)
+	}
+
+	// Artifacts missing on the primary are deleted from the secondaries.
+	direct, err := artifactservice.New(artifactservice.Options{Store: secondary})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if err := direct.UploadArtifact(ctx, newTestArtifact(t, "stale", "content")); err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	report, err = client.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+
+	if deleted := report.Deleted["secondary"]; len(deleted) != 1 || deleted[0] != "stale.tar.gz" {
+		t.Errorf("Expected the stale artifact to be deleted, got %+v", report)
+	}
+
+	if len(secondary.Paths()) != 1 {
+		t.Errorf("Expected only the primary's artifact on the secondary, got %v", secondary.Paths())
+	}
+
+	if err := client.DeleteArtifact(ctx, "test"); err != nil {
+		t.Fatalf("Failed to delete artifact: %v", err)
+	}
+
+	if len(primary.Paths()) != 0 || len(secondary.Paths()) != 0 {
+		t.Errorf("Expected artifact to be deleted everywhere, got %v and %v", primary.Paths(), secondary.Paths())
+	}
+}
+
+func TestAsyncReplicationOrder(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := artifactservicetest.NewStorage(), artifactservicetest.NewStorage()
+
+	client, err := artifactservice.NewReplicated(artifactservice.ReplicatedOptions{
+		Primary:     artifactservice.Replica{Name: "primary", Store: primary},
+		Secondaries: []artifactservice.Replica{{Name: "secondary", Store: secondary}},
+		Mode:        artifactservice.ReplicateAsync,
+		Logger:      logger.NoOp(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", fmt.Sprintf("version %d", i))); err != nil {
+			t.Fatalf("Failed to upload artifact: %v", err)
+		}
+	}
+
+	client.Wait()
+
+	expected, err := conditional(t, client).ArtifactDigest(ctx, "test")
+	if err != nil {
+		t.Fatalf("Failed to get digest: %v", err)
+	}
+
+	direct, err := artifactservice.New(artifactservice.Options{Store: secondary})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if actual, err := conditional(t, direct).ArtifactDigest(ctx, "test"); err != nil || actual != expected {
+		t.Errorf("Expected the secondary to hold the latest version, got %q (err: %v)", actual, err)
+	}
+}
+
+func TestAsyncReplicationQueue(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := artifactservicetest.NewStorage(), artifactservicetest.NewStorage()
+
+	client, err := artifactservice.NewReplicated(artifactservice.ReplicatedOptions{
+		Primary:          artifactservice.Replica{Name: "primary", Store: primary},
+		Secondaries:      []artifactservice.Replica{{Name: "secondary", Store: secondary}},
+		Mode:             artifactservice.ReplicateAsync,
+		MaxPendingWrites: 1,
+		Logger:           logger.NoOp(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	// Hold the first write to the secondary so the following ones queue up behind it.
+	writing, resume := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	secondary.OnWrite(func(path string) {
+		once.Do(func() {
+			close(writing)
+			<-resume
+		})
+	})
+
+	for i, name := range []string{"first", "second", "third"} {
+		if err := client.UploadArtifact(ctx, newTestArtifact(t, name, "content")); err != nil {
+			t.Fatalf("Failed to upload artifact: %v", err)
+		}
+
+		if i == 0 {
+			<-writing
+		}
+	}
+
+	close(resume)
+	client.Wait()
+
+	direct, err := artifactservice.New(artifactservice.Options{Store: secondary})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	for name, expected := range map[string]bool{"first": true, "second": true, "third": false} {
+		digest, err := conditional(t, direct).ArtifactDigest(ctx, name)
+		if err != nil || (digest != "") != expected {
+			t.Errorf("Expected %s to be replicated: %t, got digest %q (err: %v)", name, expected, digest, err)
+		}
+	}
+
+	report, err := client.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+
+	if repaired := report.Repaired["secondary"]; len(repaired) != 1 || repaired[0] != "third.tar.gz" {
+		t.Errorf("Expected the dropped write to be repaired, got %+v", report)
+	}
+}
+
+func TestWorkingDir(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := artifactservicetest.NewStorage(), artifactservicetest.NewStorage()
+
+	// An object outside of the working directory must be left alone.
+	primary.Put("other.bin", []byte("unrelated"))
+
+	client, err := artifactservice.NewReplicated(artifactservice.ReplicatedOptions{
+		Primary:     artifactservice.Replica{Name: "primary", Store: primary},
+		Secondaries: []artifactservice.Replica{{Name: "secondary", Store: secondary}},
+		Mode:        artifactservice.ReplicateSync,
+		WorkingDir:  "team/artifacts",
+		Logger:      logger.NoOp(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", "content")); err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	for _, path := range append(primary.Paths(), secondary.Paths()...) {
+		if path != "other.bin" && !strings.HasPrefix(path, "team/artifacts/") {
+			t.Errorf("Expected artifacts to be stored in the working directory, got %s", path)
+		}
+	}
+
+	secondary.Clear()
+	report, err := client.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+
+	if report.Checked != 1 || len(report.Repaired["secondary"]) != 1 {
+		t.Errorf("Expected only the artifact in the working directory to be repaired, got %+v", report)
+	}
+
+	if paths := secondary.Paths(); len(paths) != 1 || !strings.HasPrefix(paths[0], "team/artifacts/") {
+		t.Errorf("Expected only the artifact to be copied, got %v", paths)
+	}
+
+	// Without a working directory artifacts are stored at the root, next to unrelated objects.
+	primary.Clear()
+	secondary.Clear()
+	primary.Put("other.bin", []byte("unrelated"))
+
+	client, err = artifactservice.NewReplicated(artifactservice.ReplicatedOptions{
+		Primary:     artifactservice.Replica{Name: "primary", Store: primary},
+		Secondaries: []artifactservice.Replica{{Name: "secondary", Store: secondary}},
+		Mode:        artifactservice.ReplicateSync,
+		Logger:      logger.NoOp(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", "content")); err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	if paths := primary.Paths(); len(paths) != 2 || paths[0] != "other.bin" || paths[1] != "test.tar.gz" {
+		t.Errorf("Expected the artifact to be stored at the root, got %v", paths)
+	}
+
+	report, err = client.Reconcile(ctx)
+	if err != nil {
+		t.Fatalf("Failed to reconcile: %v", err)
+	}
+
+	if report.Checked != 1 {
+		t.Errorf("Expected only the artifact to be checked, got %+v", report)
+	}
+}
+
+func TestScopeIndex(t *testing.T) {
+	ctx := context.Background()
+	store := artifactservicetest.NewStorage()
+	client, err := artifactservice.New(artifactservice.Options{Store: store})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	scopes := artifactservice.NewScopeIndex(store, "")
+	for _, scope := range []string{"workflow/1", "workflow/2"} {
+		if err := scopes.Tag(ctx, scope, scope); err != nil {
+			t.Fatalf("Failed to tag artifact: %v", err)
+		}
+
+		if err := client.UploadArtifact(ctx, newTestArtifact(t, scope, "content")); err != nil {
+			t.Fatalf("Failed to upload artifact: %v", err)
+		}
+	}
+
+	released, err := scopes.Release(ctx, client, "workflow/1")
+	if err != nil || released != 1 {
+		t.Fatalf("Expected one released artifact, got %d (err: %v)", released, err)
+	}
+
+	if _, err := client.DownloadArtifact(ctx, "workflow/1"); err == nil {
+		t.Errorf("Expected released artifact to be deleted")
+	}
+
+	// Artifacts of a running scope are kept no matter how old they are.
+	if released, err := scopes.Sweep(ctx, client, -time.Second); err != nil || released != 0 {
+		t.Errorf("Expected no artifacts of a running scope to be swept, got %d (err: %v)", released, err)
+	}
+
+	if err := scopes.Complete(ctx, "workflow/2"); err != nil {
+		t.Fatalf("Failed to complete scope: %v", err)
+	}
+
+	if released, err := scopes.Sweep(ctx, client, time.Hour); err != nil || released != 0 {
+		t.Errorf("Expected no artifacts within the grace period to be swept, got %d (err: %v)", released, err)
+	}
+
+	if released, err := scopes.Sweep(ctx, client, -time.Second); err != nil || released != 1 {
+		t.Errorf("Expected the remaining artifact to be swept, got %d (err: %v)", released, err)
+	}
+
+	// Scopes without a completion marker are swept once the completion func reports them.
+	if err := scopes.Tag(ctx, "workflow/3", "workflow/3"); err != nil {
+		t.Fatalf("Failed to tag artifact: %v", err)
+	}
+
+	finished := artifactservice.NewScopeIndex(store, "", artifactservice.WithCompletionFunc(
+		func(ctx context.Context, scope string) (time.Time, bool, error) {
+			return time.Now().Add(-2 * time.Hour), scope == "workflow/3", nil
+		},
+	))
+
+	if released, err := finished.Sweep(ctx, client, time.Hour); err != nil || released != 1 {
+		t.Errorf("Expected the terminated scope to be swept, got %d (err: %v)", released, err)
+	}
+
+	if paths := store.Paths(); len(paths) != 0 {
+		t.Errorf("Expected storage to be empty, got %v", paths)
+	}
+
+	// An undecodable tag is skipped instead of blocking every other scope.
+	quiet := artifactservice.NewScopeIndex(store, "", artifactservice.WithScopeLogger(logger.NoOp()))
+	if err := quiet.Tag(ctx, "workflow/4", "workflow/4"); err != nil {
+		t.Fatalf("Failed to tag artifact: %v", err)
+	}
+
+	if err := quiet.Complete(ctx, "workflow/4"); err != nil {
+		t.Fatalf("Failed to complete scope: %v", err)
+	}
+
+	store.Put(".scopes/workflow%2F4/broken.tar.gz", []byte("{"))
+
+	if tags, err := quiet.List(ctx, "workflow/4"); err != nil || len(tags) != 1 {
+		t.Errorf("Expected the decodable tag to be listed, got %v (err: %v)", tags, err)
+	}
+
+	if released, err := quiet.Sweep(ctx, client, -time.Second); err != nil || released != 1 {
+		t.Errorf("Expected the decodable tag to be swept, got %d (err: %v)", released, err)
+	}
+}
+
+// recordingMetrics is a Metrics implementation that keeps what it observed.
+type recordingMetrics struct {
+	mu         sync.Mutex
+	operations map[artifactservice.Operation]int
+	bytes      map[artifactservice.Operation]int64
+	ratios     []float64
+	cacheHits  int
+	cacheMiss  int
+}
+
+func (m *recordingMetrics) ObserveOperation(op artifactservice.Operation, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.operations[op]++
+}
+
+func (m *recordingMetrics) AddBytes(op artifactservice.Operation, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytes[op] += bytes
+}
+
+func (m *recordingMetrics) ObserveCompressionRatio(ratio float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ratios = append(m.ratios, ratio)
+}
+
+func (m *recordingMetrics) ObserveCacheLookup(hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.cacheHits++
+	} else {
+		m.cacheMiss++
+	}
+}
+
+func TestMetricsAndCache(t *testing.T) {
+	ctx := context.Background()
+	metrics := &recordingMetrics{
+		operations: make(map[artifactservice.Operation]int),
+		bytes:      make(map[artifactservice.Operation]int64),
+	}
+
+	client, err := artifactservice.New(artifactservice.Options{
+		Store:      artifactservicetest.NewStorage(),
+		CommitMode: artifactservice.CommitMarker,
+		Metrics:    metrics,
+		CacheSize:  1 << 20,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", strings.Repeat("content", 100))); err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.DownloadArtifact(ctx, "test"); err != nil {
+			t.Fatalf("Failed to download artifact: %v", err)
+		}
+	}
+
+	if metrics.operations[artifactservice.OperationUpload] != 1 || metrics.operations[artifactservice.OperationDownload] != 2 {
+		t.Errorf("Unexpected operation counts: %v", metrics.operations)
+	}
+
+	if metrics.bytes[artifactservice.OperationUpload] == 0 || metrics.bytes[artifactservice.OperationUpload] != metrics.bytes[artifactservice.OperationDownload] {
+		t.Errorf("Expected the blob to be transferred once each way, got %v", metrics.bytes)
+	}
+
+	if len(metrics.ratios) != 1 || metrics.ratios[0] <= 1 {
+		t.Errorf("Expected a compression ratio above 1, got %v", metrics.ratios)
+	}
+
+	if metrics.cacheHits != 1 || metrics.cacheMiss != 1 {
+		t.Errorf("Expected one cache miss and one hit, got %d misses and %d hits", metrics.cacheMiss, metrics.cacheHits)
+	}
+
+	// Digest reads are not transfers.
+	if _, err := conditional(t, client).ArtifactDigest(ctx, "test"); err != nil {
+		t.Fatalf("Failed to get digest: %v", err)
+	}
+
+	if metrics.bytes[artifactservice.OperationUpload] != metrics.bytes[artifactservice.OperationDownload] || metrics.cacheHits+metrics.cacheMiss != 2 {
+		t.Errorf("Expected digest reads to be left out of the metrics, got %v", metrics.bytes)
+	}
+
+	// Overwritten keys cannot be told apart with CommitMove, so nothing is cached.
+	metrics.bytes = make(map[artifactservice.Operation]int64)
+	metrics.cacheHits, metrics.cacheMiss = 0, 0
+
+	client, err = artifactservice.New(artifactservice.Options{
+		Store:     artifactservicetest.NewStorage(),
+		Metrics:   metrics,
+		CacheSize: 1 << 20,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	for _, content := range []string{"first", "second"} {
+		if err := client.UploadArtifact(ctx, newTestArtifact(t, "test", content)); err != nil {
+			t.Fatalf("Failed to upload artifact: %v", err)
+		}
+
+		expected, err := conditional(t, client).ArtifactDigest(ctx, "test")
+		if err != nil {
+			t.Fatalf("Failed to get digest: %v", err)
+		}
+
+		if _, err := client.DownloadArtifact(ctx, "test"); err != nil {
+			t.Fatalf("Failed to download artifact: %v", err)
+		}
+
+		if actual, err := conditional(t, client).ArtifactDigest(ctx, "test"); err != nil || actual != expected {
+			t.Errorf("Expected the latest upload, got digest %q (err: %v)", actual, err)
+		}
+	}
+
+	if metrics.cacheHits+metrics.cacheMiss != 0 {
+		t.Errorf("Expected no cache lookups with CommitMove, got %d misses and %d hits", metrics.cacheMiss, metrics.cacheHits)
+	}
+
+	if metrics.bytes[artifactservice.OperationUpload] != metrics.bytes[artifactservice.OperationDownload] {
+		t.Errorf("Expected streamed downloads to be counted, got %v", metrics.bytes)
+	}
+
+	// A replicated client records each operation once, however many replicas it touches.
+	metrics = &recordingMetrics{
+		operations: make(map[artifactservice.Operation]int),
+		bytes:      make(map[artifactservice.Operation]int64),
+	}
+
+	replicated, err := artifactservice.NewReplicated(artifactservice.ReplicatedOptions{
+		Primary:     artifactservice.Replica{Name: "primary", Store: artifactservicetest.NewStorage()},
+		Secondaries: []artifactservice.Replica{{Name: "secondary", Store: artifactservicetest.NewStorage()}},
+		Mode:        artifactservice.ReplicateSync,
+		Metrics:     metrics,
+		Logger:      logger.NoOp(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create replicated client: %v", err)
+	}
+
+	if err := replicated.UploadArtifact(ctx, newTestArtifact(t, "test", strings.Repeat("content", 100))); err != nil {
+		t.Fatalf("Failed to upload artifact: %v", err)
+	}
+
+	if _, err := replicated.DownloadArtifact(ctx, "test"); err != nil {
+		t.Fatalf("Failed to download artifact: %v", err)
+	}
+
+	if err := replicated.DeleteArtifact(ctx, "test"); err != nil {
+		t.Fatalf("Failed to delete artifact: %v", err)
+	}
+
+	for _, op := range []artifactservice.Operation{artifactservice.OperationUpload, artifactservice.OperationDownload, artifactservice.OperationDelete} {
+		if metrics.operations[op] != 1 {
+			t.Errorf("Expected one %s operation, got %v", op, metrics.operations)
+		}
+	}
+
+	if len(metrics.ratios) != 1 || metrics.bytes[artifactservice.OperationUpload] != metrics.bytes[artifactservice.OperationDownload] {
+		t.Errorf("Expected the upload to be counted once, got %v and ratios %v", metrics.bytes, metrics.ratios)
+	}
+}
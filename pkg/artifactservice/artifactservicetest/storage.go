@@ -0,0 +1,228 @@
+// Package artifactservicetest provides an in-memory storage with injectable failures for
+// testing code built on the artifact service, such as storage locks.
+package artifactservicetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flowshot-io/polystore/pkg/types"
+)
+
+// Storage is an in-memory types.Storage for testing services backed by storage, such as
+// storage locks and artifact services. Missing objects are reported with errors matching
+// os.ErrNotExist. Multipart uploads and moves between buckets are not supported.
+type Storage struct {
+	mu        sync.Mutex
+	objects   map[string][]byte
+	failWrite func(path string) bool
+	onWrite   func(path string)
+	failMove  bool
+	failRead  bool
+}
+
+// NewStorage creates an empty Storage.
+func NewStorage() *Storage {
+	return &Storage{objects: make(map[string][]byte)}
+}
+
+// FailWrites makes writes to the paths matching fail fail after storing half of the object,
+// as if the writer crashed mid-write. A nil fail lets all writes succeed again.
+func (s *Storage) FailWrites(fail func(path string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failWrite = fail
+}
+
+// OnWrite calls hook with the path of every write before it is stored, e.g. to interleave
+// a competing writer. A nil hook removes it.
+func (s *Storage) OnWrite(hook func(path string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onWrite = hook
+}
+
+// FailMoves makes moves fail, as on backends without an atomic move.
+func (s *Storage) FailMoves(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failMove = fail
+}
+
+// FailReads makes reads and stats fail, as during a storage outage.
+func (s *Storage) FailReads(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failRead = fail
+}
+
+// Put stores an object directly, bypassing injected failures.
+func (s *Storage) Put(path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[path] = data
+}
+
+// Clear removes all objects.
+func (s *Storage) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects = make(map[string][]byte)
+}
+
+// Paths returns the sorted paths of all objects.
+func (s *Storage) Paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var paths []string
+	for path := range s.objects {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// ListWithContext returns the objects whose path starts with prefix, sorted by path.
+func (s *Storage) ListWithContext(ctx context.Context, prefix string) (*[]types.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var objects []types.Object
+	for path := range s.objects {
+		if strings.HasPrefix(path, prefix) {
+			objects = append(objects, types.Object{Path: path})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Path < objects[j].Path })
+
+	return &objects, nil
+}
+
+// ReadWithContext returns the content of an object.
+func (s *Storage) ReadWithContext(ctx context.Context, path string, start int64, end int64) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failRead {
+		return nil, errors.New("storage unavailable")
+	}
+
+	data, ok := s.objects[path]
+	if !ok {
+		return nil, fmt.Errorf("read %s: %w", path, os.ErrNotExist)
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// WriteWithContext stores an object, replacing an existing one.
+func (s *Storage) WriteWithContext(ctx context.Context, path string, reader io.Reader, size int64) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	hook := s.onWrite
+	s.mu.Unlock()
+
+	if hook != nil {
+		hook(path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failWrite != nil && s.failWrite(path) {
+		// Simulate a crash mid-write by leaving a truncated object behind.
+		s.objects[path] = data[:len(data)/2]
+		return 0, errors.New("write interrupted")
+	}
+
+	s.objects[path] = data
+	return int64(len(data)), nil
+}
+
+// StatWithContext returns the metadata of an object.
+func (s *Storage) StatWithContext(ctx context.Context, path string) (*types.Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failRead {
+		return nil, errors.New("storage unavailable")
+	}
+
+	if _, ok := s.objects[path]; !ok {
+		return nil, fmt.Errorf("stat %s: %w", path, os.ErrNotExist)
+	}
+
+	return &types.Object{Path: path, LastModified: time.Now()}, nil
+}
+
+// DeleteWithContext removes an object.
+func (s *Storage) DeleteWithContext(ctx context.Context, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objects[path]; !ok {
+		return fmt.Errorf("delete %s: %w", path, os.ErrNotExist)
+	}
+
+	delete(s.objects, path)
+	return nil
+}
+
+// MoveWithContext renames an object atomically.
+func (s *Storage) MoveWithContext(ctx context.Context, fromPath string, toPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failMove {
+		return errors.New("move not supported")
+	}
+
+	data, ok := s.objects[fromPath]
+	if !ok {
+		return fmt.Errorf("move %s: %w", fromPath, os.ErrNotExist)
+	}
+
+	s.objects[toPath] = data
+	delete(s.objects, fromPath)
+	return nil
+}
+
+func (s *Storage) MoveToBucketWithContext(ctx context.Context, srcPath, dstPath, dstBucket string) error {
+	return errors.New("not supported")
+}
+
+func (s *Storage) InitiateMultipartUploadWithContext(ctx context.Context, path string) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (s *Storage) WriteMultipartWithContext(ctx context.Context, path, uploadID string, partNumber int64, reader io.ReadSeeker, size int64) (int64, *types.CompletedPart, error) {
+	return 0, nil, errors.New("not supported")
+}
+
+func (s *Storage) CompleteMultipartUploadWithContext(ctx context.Context, path, uploadID string, completedParts []*types.CompletedPart) error {
+	return errors.New("not supported")
+}
+
+func (s *Storage) AbortMultipartUploadWithContext(ctx context.Context, path, uploadID string) error {
+	return errors.New("not supported")
+}
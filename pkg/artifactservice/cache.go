@@ -0,0 +1,67 @@
+package artifactservice
+
+import (
+	"container/list"
+	"sync"
+)
+
+// blobCache is an in-memory LRU cache of committed blobs bounded by their total size.
+// Entries are keyed by blob path, which is only unique per upload with CommitMarker, so
+// the cache must not be used with CommitMove.
+type blobCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	path string
+	data []byte
+}
+
+func newBlobCache(maxBytes int64) *blobCache {
+	return &blobCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *blobCache) get(path string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[path]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).data, true
+}
+
+func (c *blobCache) put(path string, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[path]; ok {
+		return
+	}
+
+	c.entries[path] = c.order.PushFront(&cacheEntry{path: path, data: data})
+	c.size += int64(len(data))
+
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.path)
+		c.size -= int64(len(entry.data))
+	}
+}
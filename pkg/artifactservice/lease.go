@@ -0,0 +1,238 @@
+package artifactservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/flowshot-io/polystore/pkg/types"
+)
+
+// lockSuffix marks the lock object of an artifact.
+const lockSuffix = ".lock"
+
+// DefaultLeaseTTL is the lease duration used when none is configured.
+const DefaultLeaseTTL = 30 * time.Second
+
+var (
+	// ErrLeaseHeld is matched by errors returned when a lease is held by another owner.
+	ErrLeaseHeld = errors.New("lease is held by another owner")
+	// ErrLeaseLost is returned when renewing or releasing a lease that is no longer held.
+	ErrLeaseLost = errors.New("lease is no longer held")
+)
+
+// LeaseHeldError is returned when a lease cannot be acquired because another owner holds it.
+type LeaseHeldError struct {
+	Name      string
+	Owner     string
+	ExpiresAt time.Time
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("lease on %s is held by %s until %s", e.Name, e.Owner, e.ExpiresAt.Format(time.RFC3339))
+}
+
+// Is reports whether the target is ErrLeaseHeld.
+func (e *LeaseHeldError) Is(target error) bool {
+	return target == ErrLeaseHeld
+}
+
+// lockRecord is the content of a lock object in storage.
+type lockRecord struct {
+	Owner     string    `json:"owner"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Locker hands out leases on named resources backed by lock objects in storage.
+//
+// The storage interface offers no conditional writes, so a lease is verified by reading
+// the lock object back after writing it. This detects most races between owners but is
+// not a substitute for a consensus system; keep lease TTLs well above clock skew.
+type Locker struct {
+	store      types.Storage
+	workingDir string
+}
+
+// Lease is a time limited claim on a named resource.
+type Lease struct {
+	Name  string
+	Owner string
+
+	mu        sync.Mutex
+	locker    *Locker
+	token     string
+	ttl       time.Duration
+	expiresAt time.Time
+}
+
+// NewLocker returns a Locker storing its lock objects under the working directory.
+func NewLocker(store types.Storage, workingDir string) *Locker {
+	return &Locker{
+		store:      store,
+		workingDir: workingDir,
+	}
+}
+
+// Acquire takes the lease on name for owner. An expired lease is taken over; a live lease
+// results in a *LeaseHeldError, even if it is held by the same owner. Owner names may be
+// shared, e.g. by concurrent calls of one client, so only the Lease itself proves it holds the
+// lock; use Renew to extend it.
+func (l *Locker) Acquire(ctx context.Context, name string, owner string, ttl time.Duration) (*Lease, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("lease owner is required")
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+
+	current, err := l.read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil && time.Now().Before(current.ExpiresAt) {
+		return nil, &LeaseHeldError{Name: name, Owner: current.Owner, ExpiresAt: current.ExpiresAt}
+	}
+
+	token, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &Lease{
+		Name:   name,
+		Owner:  owner,
+		locker: l,
+		token:  token,
+		ttl:    ttl,
+	}
+
+	if err := lease.write(ctx); err != nil {
+		return nil, err
+	}
+
+	// Read the record back to detect a concurrent owner overwriting our write.
+	current, err = l.read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if current == nil || current.Token != token {
+		if current == nil {
+			return nil, fmt.Errorf("%w: %s", ErrLeaseLost, name)
+		}
+		return nil, &LeaseHeldError{Name: name, Owner: current.Owner, ExpiresAt: current.ExpiresAt}
+	}
+
+	return lease, nil
+}
+
+// ExpiresAt returns the time at which the lease expires unless renewed.
+func (l *Lease) ExpiresAt() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.expiresAt
+}
+
+// Renew extends the lease by its TTL. It returns ErrLeaseLost if another owner has
+// taken over the lease in the meantime.
+func (l *Lease) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.verify(ctx); err != nil {
+		return err
+	}
+
+	return l.write(ctx)
+}
+
+// Release gives up the lease. Releasing a lease that has been taken over by another
+// owner returns ErrLeaseLost and leaves the other owner's lock in place.
+func (l *Lease) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.verify(ctx); err != nil {
+		return err
+	}
+
+	return l.locker.store.DeleteWithContext(ctx, l.locker.getLockPath(l.Name))
+}
+
+func (l *Lease) verify(ctx context.Context) error {
+	current, err := l.locker.read(ctx, l.Name)
+	if err != nil {
+		return err
+	}
+
+	if current == nil || current.Token != l.token {
+		return fmt.Errorf("%w: %s", ErrLeaseLost, l.Name)
+	}
+
+	return nil
+}
+
+func (l *Lease) write(ctx context.Context) error {
+	expiresAt := time.Now().Add(l.ttl)
+	data, err := json.Marshal(lockRecord{Owner: l.Owner, Token: l.token, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.locker.store.WriteWithContext(ctx, l.locker.getLockPath(l.Name), bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("error writing lease %s: %w", l.Name, err)
+	}
+
+	l.expiresAt = expiresAt
+	return nil
+}
+
+// read returns the current lock record of name, or nil if there is none.
+func (l *Locker) read(ctx context.Context, name string) (*lockRecord, error) {
+	path := l.getLockPath(name)
+
+	// Only a missing lock object means the lock is free; any other failure leaves the
+	// state of the lock unknown.
+	if _, err := l.store.StatWithContext(ctx, path); err != nil {
+		if isNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading lease %s: %w", name, err)
+	}
+
+	reader, err := l.store.ReadWithContext(ctx, path, 0, 0)
+	if err != nil {
+		if isNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading lease %s: %w", name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var record lockRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		// A lock object that cannot be decoded was not written completely and holds nothing.
+		return nil, nil
+	}
+
+	return &record, nil
+}
+
+func (l *Locker) getLockPath(name string) string {
+	return filepath.Join(l.workingDir, name) + lockSuffix
+}
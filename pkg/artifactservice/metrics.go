@@ -0,0 +1,128 @@
+package artifactservice
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operation identifies an artifact service operation in metrics.
+type Operation string
+
+const (
+	OperationUpload   Operation = "upload"
+	OperationDownload Operation = "download"
+	OperationDelete   Operation = "delete"
+)
+
+// Metrics records statistics about artifact service operations.
+type Metrics interface {
+	// ObserveOperation records the duration and outcome of an operation.
+	ObserveOperation(op Operation, duration time.Duration, err error)
+	// AddBytes records bytes transferred to or from storage by an operation.
+	AddBytes(op Operation, bytes int64)
+	// ObserveCompressionRatio records the ratio of uncompressed to compressed size of an uploaded artifact.
+	ObserveCompressionRatio(ratio float64)
+	// ObserveCacheLookup records whether a download was served from the local cache.
+	ObserveCacheLookup(hit bool)
+}
+
+// NoOpMetrics returns a Metrics implementation which discards everything.
+func NoOpMetrics() Metrics {
+	return noOpMetrics{}
+}
+
+type noOpMetrics struct{}
+
+func (noOpMetrics) ObserveOperation(op Operation, duration time.Duration, err error) {}
+func (noOpMetrics) AddBytes(op Operation, bytes int64)                               {}
+func (noOpMetrics) ObserveCompressionRatio(ratio float64)                            {}
+func (noOpMetrics) ObserveCacheLookup(hit bool)                                      {}
+
+// PrometheusMetrics implements Metrics with Prometheus collectors.
+type PrometheusMetrics struct {
+	operations  *prometheus.HistogramVec
+	errors      *prometheus.CounterVec
+	bytes       *prometheus.CounterVec
+	compression prometheus.Histogram
+	cache       *prometheus.CounterVec
+}
+
+// NewPrometheusMetrics creates the artifact service collectors under the namespace and
+// registers them with the registerer (prometheus.DefaultRegisterer if nil).
+func NewPrometheusMetrics(registerer prometheus.Registerer, namespace string) (*PrometheusMetrics, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	m := &PrometheusMetrics{
+		operations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "artifactservice",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of artifact service operations.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+		}, []string{"operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "artifactservice",
+			Name:      "operation_errors_total",
+			Help:      "Number of failed artifact service operations.",
+		}, []string{"operation"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "artifactservice",
+			Name:      "transferred_bytes_total",
+			Help:      "Bytes transferred to and from storage.",
+		}, []string{"operation"}),
+		compression: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "artifactservice",
+			Name:      "compression_ratio",
+			Help:      "Ratio of uncompressed to compressed size of uploaded artifacts.",
+			Buckets:   []float64{1, 1.5, 2, 3, 5, 10, 20},
+		}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "artifactservice",
+			Name:      "cache_lookups_total",
+			Help:      "Number of download cache lookups by result.",
+		}, []string{"result"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.operations, m.errors, m.bytes, m.compression, m.cache} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// ObserveOperation records the duration and outcome of an operation.
+func (m *PrometheusMetrics) ObserveOperation(op Operation, duration time.Duration, err error) {
+	m.operations.WithLabelValues(string(op)).Observe(duration.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(string(op)).Inc()
+	}
+}
+
+// AddBytes records bytes transferred to or from storage by an operation.
+func (m *PrometheusMetrics) AddBytes(op Operation, bytes int64) {
+	m.bytes.WithLabelValues(string(op)).Add(float64(bytes))
+}
+
+// ObserveCompressionRatio records the compression ratio of an uploaded artifact.
+func (m *PrometheusMetrics) ObserveCompressionRatio(ratio float64) {
+	m.compression.Observe(ratio)
+}
+
+// ObserveCacheLookup records whether a download was served from the local cache.
+func (m *PrometheusMetrics) ObserveCacheLookup(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	m.cache.WithLabelValues(result).Inc()
+}
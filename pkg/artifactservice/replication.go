@@ -0,0 +1,532 @@
+package artifactservice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flowshot-io/polystore/pkg/types"
+	"github.com/flowshot-io/x/pkg/artifact"
+	"github.com/flowshot-io/x/pkg/logger"
+)
+
+const (
+	// DefaultHealthCooldown is how long a replica that failed a read is skipped by default.
+	DefaultHealthCooldown = 30 * time.Second
+	// DefaultMaxPendingWrites is the number of asynchronous writes queued per secondary by default.
+	DefaultMaxPendingWrites = 1000
+)
+
+// ReplicationMode defines when writes are applied to secondary replicas.
+type ReplicationMode int
+
+const (
+	// ReplicateAsync applies writes to secondaries in the background after the primary succeeded.
+	// Queued writes are lost if the process exits before they are applied, so call
+	// ReplicatedClient.Wait before exiting and run Reconcile to repair what was missed.
+	ReplicateAsync ReplicationMode = iota
+	// ReplicateSync applies writes to all secondaries before returning.
+	ReplicateSync
+)
+
+// Replica is a named storage location holding a copy of the artifacts.
+type Replica struct {
+	Name  string
+	Store types.Storage
+}
+
+// ReplicatedOptions holds the configuration for a replicated artifact service.
+// Primary receives every write first; Secondaries receive copies according to Mode.
+// ReadOrder lists replica names from nearest to farthest; replicas it leaves out are read last, the primary
+// first followed by the secondaries (defaults to the primary followed by the secondaries).
+// HealthCooldown sets how long a replica that failed a read is tried last (defaults to DefaultHealthCooldown).
+// MaxPendingWrites limits the asynchronous writes queued per secondary (defaults to DefaultMaxPendingWrites);
+// writes beyond it are dropped and logged, leaving the secondary to be repaired by Reconcile.
+// WorkingDir, CommitMode, LeaseOwner, LeaseTTL and CacheSize are applied to every replica as in Options.
+// Metrics records each operation once, however many replicas it touches (defaults to NoOpMetrics).
+type ReplicatedOptions struct {
+	Primary          Replica
+	Secondaries      []Replica
+	Mode             ReplicationMode
+	ReadOrder        []string
+	HealthCooldown   time.Duration
+	MaxPendingWrites int
+	WorkingDir       string
+	CommitMode       CommitMode
+	LeaseOwner       string
+	LeaseTTL         time.Duration
+	Metrics          Metrics
+	CacheSize        int64
+	Logger           logger.Logger
+}
+
+// ReplicationError is returned when a write succeeded on the primary but failed on secondaries.
+type ReplicationError struct {
+	Name     string
+	Failures map[string]error
+}
+
+func (e *ReplicationError) Error() string {
+	var failures []string
+	for replica, err := range e.Failures {
+		failures = append(failures, fmt.Sprintf("%s: %v", replica, err))
+	}
+
+	return fmt.Sprintf("error replicating artifact %s: %s", e.Name, strings.Join(failures, "; "))
+}
+
+// ReconcileReport describes the outcome of a reconciliation run.
+// Repaired, Deleted and Failed are keyed by replica name and list artifact names.
+type ReconcileReport struct {
+	Checked  int
+	Repaired map[string][]string
+	Deleted  map[string][]string
+	Failed   map[string][]string
+}
+
+// ReplicatedClient implements the ArtifactServiceClient interface on top of several replicas.
+type ReplicatedClient struct {
+	primary     *replica
+	secondaries []*replica
+	readOrder   []*replica
+	mode        ReplicationMode
+	cooldown    time.Duration
+	maxPending  int
+	logger      logger.Logger
+	metrics     Metrics
+	pending     sync.WaitGroup
+}
+
+type replica struct {
+	name           string
+	client         *Client
+	mu             sync.Mutex
+	unhealthyUntil time.Time
+	queue          []func()
+	draining       bool
+}
+
+// NewReplicated returns a new instance of a replicated ArtifactServiceClient.
+func NewReplicated(opts ReplicatedOptions) (*ReplicatedClient, error) {
+	if opts.Logger == nil {
+		opts.Logger = logger.New()
+	}
+
+	if opts.HealthCooldown <= 0 {
+		opts.HealthCooldown = DefaultHealthCooldown
+	}
+
+	if opts.MaxPendingWrites <= 0 {
+		opts.MaxPendingWrites = DefaultMaxPendingWrites
+	}
+
+	if opts.Metrics == nil {
+		opts.Metrics = NoOpMetrics()
+	}
+
+	c := &ReplicatedClient{
+		mode:       opts.Mode,
+		cooldown:   opts.HealthCooldown,
+		maxPending: opts.MaxPendingWrites,
+		logger:     opts.Logger,
+		metrics:    opts.Metrics,
+	}
+
+	replicas := make(map[string]*replica)
+	for i, r := range append([]Replica{opts.Primary}, opts.Secondaries...) {
+		if r.Name == "" {
+			return nil, fmt.Errorf("replica name is required")
+		}
+
+		if _, ok := replicas[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate replica name: %s", r.Name)
+		}
+
+		client, err := New(Options{
+			Store:      r.Store,
+			WorkingDir: opts.WorkingDir,
+			CommitMode: opts.CommitMode,
+			LeaseOwner: opts.LeaseOwner,
+			LeaseTTL:   opts.LeaseTTL,
+			Metrics:    opts.Metrics,
+			CacheSize:  opts.CacheSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating replica %s: %w", r.Name, err)
+		}
+
+		rep := &replica{name: r.Name, client: client.(*Client)}
+		replicas[r.Name] = rep
+
+		if i == 0 {
+			c.primary = rep
+		} else {
+			c.secondaries = append(c.secondaries, rep)
+		}
+	}
+
+	listed := make(map[*replica]bool)
+	for _, name := range opts.ReadOrder {
+		rep, ok := replicas[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown replica in read order: %s", name)
+		}
+
+		if listed[rep] {
+			return nil, fmt.Errorf("duplicate replica in read order: %s", name)
+		}
+
+		listed[rep] = true
+		c.readOrder = append(c.readOrder, rep)
+	}
+
+	// A replica left out of the read order still serves reads once the listed ones failed.
+	for _, rep := range append([]*replica{c.primary}, c.secondaries...) {
+		if !listed[rep] {
+			c.readOrder = append(c.readOrder, rep)
+		}
+	}
+
+	return c, nil
+}
+
+// UploadArtifact uploads an artifact to the primary and replicates it to the secondaries.
+func (c *ReplicatedClient) UploadArtifact(ctx context.Context, artifact artifact.Artifact) (err error) {
+	defer c.observe(OperationUpload, time.Now(), &err)
+
+	var buf bytes.Buffer
+	if err := artifact.SaveToWriter(&buf); err != nil {
+		return err
+	}
+
+	data := buf.Bytes()
+	if err := c.primary.client.writeBlob(ctx, artifact.GetName(), data, nil); err != nil {
+		return err
+	}
+
+	recordUpload(c.metrics, data)
+
+	return c.replicate(ctx, artifact.GetName(), func(ctx context.Context, r *replica) error {
+		return r.client.writeBlob(ctx, artifact.GetName(), data, nil)
+	})
+}
+
+// UploadArtifactIfMatch performs a conditional upload against the primary and replicates
+// the result to the secondaries.
+func (c *ReplicatedClient) UploadArtifactIfMatch(ctx context.Context, artifact artifact.Artifact, previousDigest string) (_ string, err error) {
+	defer c.observe(OperationUpload, time.Now(), &err)
+
+	var buf bytes.Buffer
+	if err := artifact.SaveToWriter(&buf); err != nil {
+		return "", err
+	}
+
+	data := buf.Bytes()
+	digest, err := c.primary.client.writeBlobIfMatch(ctx, artifact.GetName(), data, previousDigest)
+	if err != nil {
+		return "", err
+	}
+
+	recordUpload(c.metrics, data)
+
+	return digest, c.replicate(ctx, artifact.GetName(), func(ctx context.Context, r *replica) error {
+		return r.client.writeBlob(ctx, artifact.GetName(), data, nil)
+	})
+}
+
+// DownloadArtifact downloads an artifact from the nearest healthy replica, falling back to
+// the other replicas in read order.
+func (c *ReplicatedClient) DownloadArtifact(ctx context.Context, artifactName string) (_ artifact.Artifact, err error) {
+	defer c.observe(OperationDownload, time.Now(), &err)
+
+	var lastErr error
+	for _, r := range c.readCandidates() {
+		a, err := r.client.downloadArtifact(ctx, artifactName)
+		if err == nil {
+			return a, nil
+		}
+
+		// A missing artifact is expected on a secondary that has not caught up yet.
+		if !isNotExist(err) {
+			c.markUnhealthy(r, err)
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// ArtifactDigest returns the digest of the artifact on the primary, which is authoritative
+// for conditional uploads.
+func (c *ReplicatedClient) ArtifactDigest(ctx context.Context, artifactName string) (string, error) {
+	return c.primary.client.ArtifactDigest(ctx, artifactName)
+}
+
+// DeleteArtifact deletes an artifact from the primary and the secondaries.
+func (c *ReplicatedClient) DeleteArtifact(ctx context.Context, artifactName string) (err error) {
+	defer c.observe(OperationDelete, time.Now(), &err)
+
+	if err := c.primary.client.deleteArtifact(ctx, artifactName); err != nil {
+		return err
+	}
+
+	return c.replicate(ctx, artifactName, func(ctx context.Context, r *replica) error {
+		err := r.client.deleteArtifact(ctx, artifactName)
+		if err != nil && isNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Wait blocks until all asynchronous replication started so far has finished. Call it before
+// the process exits, since queued writes are not persisted.
+func (c *ReplicatedClient) Wait() {
+	c.pending.Wait()
+}
+
+// Reconcile compares every committed artifact on the primary with the secondaries, copies
+// it to any secondary where it is missing or differs and deletes artifacts from secondaries
+// that no longer exist on the primary.
+func (c *ReplicatedClient) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	names, err := c.primary.client.listArtifacts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing artifacts on %s: %w", c.primary.name, err)
+	}
+
+	report := &ReconcileReport{
+		Repaired: make(map[string][]string),
+		Deleted:  make(map[string][]string),
+		Failed:   make(map[string][]string),
+	}
+
+	onPrimary := make(map[string]bool, len(names))
+	for _, name := range names {
+		onPrimary[name] = true
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		report.Checked++
+
+		expected, err := c.primary.client.ArtifactDigest(ctx, name)
+		if err != nil || expected == "" {
+			// The artifact was deleted or replaced since it was listed.
+			continue
+		}
+
+		var data []byte
+		for _, r := range c.secondaries {
+			actual, err := r.client.ArtifactDigest(ctx, name)
+			if err == nil && actual == expected {
+				continue
+			}
+
+			if data == nil {
+				if data, err = c.primary.client.readBlob(ctx, name); err != nil {
+					report.Failed[r.name] = append(report.Failed[r.name], name)
+					continue
+				}
+			}
+
+			if err := r.client.writeBlob(ctx, name, data, nil); err != nil {
+				c.logger.Error("Error repairing artifact replica", map[string]interface{}{
+					"artifact": name,
+					"replica":  r.name,
+					"error":    err.Error(),
+				})
+				report.Failed[r.name] = append(report.Failed[r.name], name)
+				continue
+			}
+
+			report.Repaired[r.name] = append(report.Repaired[r.name], name)
+		}
+	}
+
+	for _, r := range c.secondaries {
+		if err := c.pruneReplica(ctx, r, onPrimary, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// pruneReplica deletes artifacts from a secondary that do not exist on the primary.
+func (c *ReplicatedClient) pruneReplica(ctx context.Context, r *replica, onPrimary map[string]bool, report *ReconcileReport) error {
+	names, err := r.client.listArtifacts(ctx)
+	if err != nil {
+		c.logger.Error("Error listing artifact replica", map[string]interface{}{
+			"replica": r.name,
+			"error":   err.Error(),
+		})
+		return nil
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if onPrimary[name] {
+			continue
+		}
+
+		// The artifact may have been uploaded after the primary was listed.
+		if digest, err := c.primary.client.ArtifactDigest(ctx, name); err != nil || digest != "" {
+			continue
+		}
+
+		if err := r.client.deleteArtifact(ctx, name); err != nil && !isNotExist(err) {
+			c.logger.Error("Error deleting stale artifact replica", map[string]interface{}{
+				"artifact": name,
+				"replica":  r.name,
+				"error":    err.Error(),
+			})
+			report.Failed[r.name] = append(report.Failed[r.name], name)
+			continue
+		}
+
+		report.Deleted[r.name] = append(report.Deleted[r.name], name)
+	}
+
+	return nil
+}
+
+// replicate applies a write to every secondary according to the replication mode.
+func (c *ReplicatedClient) replicate(ctx context.Context, name string, write func(ctx context.Context, r *replica) error) error {
+	if c.mode == ReplicateAsync {
+		for _, r := range c.secondaries {
+			r := r
+
+			queued := c.enqueue(r, func() {
+				// The caller's context may end as soon as the primary write returns.
+				if err := write(context.Background(), r); err != nil {
+					c.logger.Error("Error replicating artifact", map[string]interface{}{
+						"artifact": name,
+						"replica":  r.name,
+						"error":    err.Error(),
+					})
+				}
+			})
+
+			if !queued {
+				c.logger.Error("Replication queue full, dropping write", map[string]interface{}{
+					"artifact": name,
+					"replica":  r.name,
+				})
+			}
+		}
+
+		return nil
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failures := make(map[string]error)
+	for _, r := range c.secondaries {
+		r := r
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := write(ctx, r); err != nil {
+				mu.Lock()
+				failures[r.name] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return &ReplicationError{Name: name, Failures: failures}
+	}
+
+	return nil
+}
+
+// enqueue schedules an asynchronous write to a secondary. Writes to the same secondary are
+// applied one at a time in the order they were enqueued, so an older write never overwrites
+// a newer one. It reports false and drops the write if the queue of the secondary is full.
+func (c *ReplicatedClient) enqueue(r *replica, job func()) bool {
+	r.mu.Lock()
+	if len(r.queue) >= c.maxPending {
+		r.mu.Unlock()
+		return false
+	}
+
+	c.pending.Add(1)
+	r.queue = append(r.queue, job)
+	if r.draining {
+		r.mu.Unlock()
+		return true
+	}
+	r.draining = true
+	r.mu.Unlock()
+
+	go c.drain(r)
+	return true
+}
+
+// drain applies the queued writes of a secondary until its queue is empty.
+func (c *ReplicatedClient) drain(r *replica) {
+	for {
+		r.mu.Lock()
+		if len(r.queue) == 0 {
+			r.draining = false
+			r.mu.Unlock()
+			return
+		}
+		job := r.queue[0]
+		r.queue[0] = nil
+		r.queue = r.queue[1:]
+		r.mu.Unlock()
+
+		job()
+		c.pending.Done()
+	}
+}
+
+// readCandidates returns the replicas in read order with unhealthy replicas moved to the end.
+func (c *ReplicatedClient) readCandidates() []*replica {
+	now := time.Now()
+
+	var healthy, unhealthy []*replica
+	for _, r := range c.readOrder {
+		r.mu.Lock()
+		ok := now.After(r.unhealthyUntil)
+		r.mu.Unlock()
+
+		if ok {
+			healthy = append(healthy, r)
+		} else {
+			unhealthy = append(unhealthy, r)
+		}
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+func (c *ReplicatedClient) markUnhealthy(r *replica, err error) {
+	r.mu.Lock()
+	r.unhealthyUntil = time.Now().Add(c.cooldown)
+	r.mu.Unlock()
+
+	c.logger.Warn("Artifact replica marked unhealthy", map[string]interface{}{
+		"replica": r.name,
+		"error":   err.Error(),
+	})
+}
+
+// observe records the duration and outcome of an operation started at start.
+func (c *ReplicatedClient) observe(op Operation, start time.Time, err *error) {
+	c.metrics.ObserveOperation(op, time.Since(start), *err)
+}
@@ -0,0 +1,362 @@
+package artifactservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/flowshot-io/polystore/pkg/types"
+	"github.com/flowshot-io/x/pkg/artifact"
+	"github.com/flowshot-io/x/pkg/logger"
+)
+
+// scopeDir is the directory below the working directory holding scope tags.
+const scopeDir = ".scopes"
+
+// completionMarker is the name of the object recording that a scope has finished. Tags are
+// named after artifacts, which always end in .tar.gz, so the marker never collides with one.
+const completionMarker = ".completed"
+
+// errUndecodable is matched by errors returned for scope objects that cannot be decoded,
+// e.g. because their write was interrupted.
+var errUndecodable = errors.New("undecodable scope object")
+
+// ScopedArtifact is an artifact tagged as owned by a scope, such as a workflow execution.
+type ScopedArtifact struct {
+	Scope     string    `json:"scope"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CompletionFunc reports whether a scope has finished and when. Sweep uses it for scopes
+// that never recorded their completion, such as terminated workflows.
+type CompletionFunc func(ctx context.Context, scope string) (completedAt time.Time, completed bool, err error)
+
+// ScopeOption configures a ScopeIndex.
+type ScopeOption func(*ScopeIndex)
+
+// WithCompletionFunc sets the function Sweep asks about scopes without a completion marker.
+func WithCompletionFunc(fn CompletionFunc) ScopeOption {
+	return func(s *ScopeIndex) {
+		s.completion = fn
+	}
+}
+
+// WithScopeLogger sets the logger reporting skipped scope objects (defaults to logger.New()).
+func WithScopeLogger(l logger.Logger) ScopeOption {
+	return func(s *ScopeIndex) {
+		s.logger = l
+	}
+}
+
+// ScopeIndex records which artifacts are owned by which scope so that they can be
+// deleted together once the scope has finished.
+type ScopeIndex struct {
+	store      types.Storage
+	workingDir string
+	completion CompletionFunc
+	logger     logger.Logger
+}
+
+type scopeCompletion struct {
+	Scope       string    `json:"scope"`
+	CompletedAt time.Time `json:"completedAt"`
+}
+
+// NewScopeIndex returns a ScopeIndex storing its tags under the working directory.
+func NewScopeIndex(store types.Storage, workingDir string, opts ...ScopeOption) *ScopeIndex {
+	s := &ScopeIndex{
+		store:      store,
+		workingDir: workingDir,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.logger == nil {
+		s.logger = logger.New()
+	}
+
+	return s
+}
+
+// Tag marks an artifact as owned by scope.
+// Tag before uploading, so an upload interrupted by a crash is still cleaned up.
+func (s *ScopeIndex) Tag(ctx context.Context, scope string, artifactName string) error {
+	if scope == "" {
+		return fmt.Errorf("scope is required")
+	}
+
+	tag := ScopedArtifact{
+		Scope:     scope,
+		Name:      artifact.New(artifactName).GetName(),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	data, err := json.Marshal(tag)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.store.WriteWithContext(ctx, s.getTagPath(scope, tag.Name), bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("error tagging artifact %s with scope %s: %w", tag.Name, scope, err)
+	}
+
+	return nil
+}
+
+// Untag removes the scope tag of an artifact without deleting the artifact.
+func (s *ScopeIndex) Untag(ctx context.Context, scope string, artifactName string) error {
+	return s.store.DeleteWithContext(ctx, s.getTagPath(scope, artifact.New(artifactName).GetName()))
+}
+
+// List returns the artifacts owned by scope.
+func (s *ScopeIndex) List(ctx context.Context, scope string) ([]ScopedArtifact, error) {
+	tags, _, err := s.scan(ctx, s.getScopePath(scope)+"/")
+	return tags, err
+}
+
+// Complete records that scope has finished. Sweep measures its grace period from the
+// earliest recorded completion, so completing a scope again does not postpone its cleanup.
+func (s *ScopeIndex) Complete(ctx context.Context, scope string) error {
+	if scope == "" {
+		return fmt.Errorf("scope is required")
+	}
+
+	markerPath := path.Join(s.getScopePath(scope), completionMarker)
+
+	// An undecodable marker holds no completion time and is overwritten.
+	existing, err := s.readCompletion(ctx, markerPath)
+	if err != nil && !errors.Is(err, errUndecodable) {
+		return err
+	}
+
+	if existing != nil {
+		return nil
+	}
+
+	data, err := json.Marshal(scopeCompletion{Scope: scope, CompletedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.store.WriteWithContext(ctx, markerPath, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("error recording completion of scope %s: %w", scope, err)
+	}
+
+	return nil
+}
+
+// Release deletes every artifact owned by scope through the client and removes their tags
+// and the completion marker of the scope. It returns the number of artifacts released.
+func (s *ScopeIndex) Release(ctx context.Context, client ArtifactServiceClient, scope string) (int, error) {
+	tags, err := s.List(ctx, scope)
+	if err != nil {
+		return 0, err
+	}
+
+	released, err := s.release(ctx, client, tags)
+	if err != nil {
+		return released, err
+	}
+
+	return released, s.removeCompletion(ctx, scope)
+}
+
+// Sweep releases the artifacts of every scope that completed longer than the grace period
+// ago. A scope counts as completed once Complete was called for it or, failing that, once the
+// CompletionFunc reports it as completed. Scopes that are still running are never swept, no
+// matter how old their artifacts are. It returns the number of artifacts released.
+func (s *ScopeIndex) Sweep(ctx context.Context, client ArtifactServiceClient, gracePeriod time.Duration) (int, error) {
+	tags, completions, err := s.scan(ctx, path.Join(s.workingDir, scopeDir)+"/")
+	if err != nil {
+		return 0, err
+	}
+
+	byScope := make(map[string][]ScopedArtifact)
+	for _, tag := range tags {
+		byScope[tag.Scope] = append(byScope[tag.Scope], tag)
+	}
+
+	// Completed scopes whose artifacts are all gone only need their marker removed.
+	for scope := range completions {
+		if _, ok := byScope[scope]; !ok {
+			byScope[scope] = nil
+		}
+	}
+
+	cutoff := time.Now().Add(-gracePeriod)
+
+	released := 0
+	for scope, scopeTags := range byScope {
+		completedAt, ok := completions[scope]
+		if !ok {
+			if s.completion == nil {
+				continue
+			}
+
+			var completed bool
+			if completedAt, completed, err = s.completion(ctx, scope); err != nil {
+				return released, fmt.Errorf("error checking completion of scope %s: %w", scope, err)
+			}
+
+			if !completed {
+				continue
+			}
+		}
+
+		if !completedAt.Before(cutoff) {
+			continue
+		}
+
+		n, err := s.release(ctx, client, scopeTags)
+		released += n
+		if err != nil {
+			return released, err
+		}
+
+		if err := s.removeCompletion(ctx, scope); err != nil {
+			return released, err
+		}
+	}
+
+	return released, nil
+}
+
+func (s *ScopeIndex) release(ctx context.Context, client ArtifactServiceClient, tags []ScopedArtifact) (int, error) {
+	released := 0
+	for _, tag := range tags {
+		if err := client.DeleteArtifact(ctx, tag.Name); err != nil && !isNotExist(err) {
+			return released, fmt.Errorf("error deleting scoped artifact %s: %w", tag.Name, err)
+		}
+
+		if err := s.Untag(ctx, tag.Scope, tag.Name); err != nil && !isNotExist(err) {
+			return released, fmt.Errorf("error removing scope tag of artifact %s: %w", tag.Name, err)
+		}
+
+		released++
+	}
+
+	return released, nil
+}
+
+func (s *ScopeIndex) removeCompletion(ctx context.Context, scope string) error {
+	err := s.store.DeleteWithContext(ctx, path.Join(s.getScopePath(scope), completionMarker))
+	if err != nil && !isNotExist(err) {
+		return fmt.Errorf("error removing completion marker of scope %s: %w", scope, err)
+	}
+
+	return nil
+}
+
+// scan returns the tags and the completion times of the scopes below prefix. Objects that
+// cannot be decoded are logged and skipped, so a single corrupt object does not block the
+// cleanup of every other scope.
+func (s *ScopeIndex) scan(ctx context.Context, prefix string) ([]ScopedArtifact, map[string]time.Time, error) {
+	objects, err := s.store.ListWithContext(ctx, prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tags []ScopedArtifact
+	completions := make(map[string]time.Time)
+	for _, object := range *objects {
+		if path.Base(object.Path) == completionMarker {
+			completion, err := s.readCompletion(ctx, object.Path)
+			if errors.Is(err, errUndecodable) {
+				s.skip(object.Path, err)
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if completion != nil {
+				completions[completion.Scope] = completion.CompletedAt
+			}
+			continue
+		}
+
+		var tag ScopedArtifact
+		found, err := s.readJSON(ctx, object.Path, &tag)
+		if errors.Is(err, errUndecodable) {
+			s.skip(object.Path, err)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading scope tag %s: %w", object.Path, err)
+		}
+
+		if found {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, completions, nil
+}
+
+func (s *ScopeIndex) skip(objectPath string, err error) {
+	s.logger.Warn("Skipping undecodable scope object", map[string]interface{}{
+		"path":  objectPath,
+		"error": err.Error(),
+	})
+}
+
+func (s *ScopeIndex) readCompletion(ctx context.Context, markerPath string) (*scopeCompletion, error) {
+	var completion scopeCompletion
+	found, err := s.readJSON(ctx, markerPath, &completion)
+	if err != nil {
+		return nil, fmt.Errorf("error reading completion marker %s: %w", markerPath, err)
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	return &completion, nil
+}
+
+// readJSON decodes the object at objectPath into v. It reports false if the object does not
+// exist, and an error matching errUndecodable if it is not valid JSON.
+func (s *ScopeIndex) readJSON(ctx context.Context, objectPath string, v interface{}) (bool, error) {
+	reader, err := s.store.ReadWithContext(ctx, objectPath, 0, 0)
+	if err != nil {
+		if isNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal(content, v); err != nil {
+		return false, fmt.Errorf("%w: %v", errUndecodable, err)
+	}
+
+	return true, nil
+}
+
+func (s *ScopeIndex) getScopePath(scope string) string {
+	return path.Join(s.workingDir, scopeDir, url.PathEscape(scope))
+}
+
+func (s *ScopeIndex) getTagPath(scope string, artifactName string) string {
+	return path.Join(s.getScopePath(scope), url.PathEscape(artifactName))
+}
+
+// isScopePath reports whether a path relative to the working directory holds a scope tag.
+func isScopePath(name string) bool {
+	return strings.HasPrefix(name, scopeDir+"/")
+}
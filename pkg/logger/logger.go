@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 
@@ -30,6 +32,12 @@ type (
 
 	// Option defines a function which sets an option on the Options struct.
 	Option func(*Options)
+
+	// fieldLogger adds fields to every entry logged through a Logger.
+	fieldLogger struct {
+		logger Logger
+		fields map[string]interface{}
+	}
 )
 
 // WithLogLevel sets the log level on the Options struct.
@@ -72,6 +80,83 @@ func New(opts ...Option) Logger {
 	return zerologadapter.New(logger)
 }
 
+// ErrInvalidLogLevel is returned when setting a log level which is not one of trace, debug,
+// info, warn or error.
+var ErrInvalidLogLevel = errors.New("invalid log level")
+
+// SetLevel changes the level of logs to show for all loggers created by New at runtime.
+func SetLevel(level string) error {
+	switch level {
+	case "trace":
+		zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	case "debug", "info", "warn", "error":
+		zerolog.SetGlobalLevel(parseLogLevel(level))
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidLogLevel, level)
+	}
+
+	return nil
+}
+
+// GetLevel returns the level of logs currently shown by the loggers created by New.
+func GetLevel() string {
+	return zerolog.GlobalLevel().String()
+}
+
+// WithFields returns a child Logger adding the fields to every entry logged through l.
+// Fields passed to a single call take precedence over them.
+func WithFields(l Logger, fields map[string]interface{}) Logger {
+	merged := make(map[string]interface{}, len(fields))
+	if parent, ok := l.(*fieldLogger); ok {
+		l = parent.logger
+		for key, value := range parent.fields {
+			merged[key] = value
+		}
+	}
+
+	for key, value := range fields {
+		merged[key] = value
+	}
+
+	return &fieldLogger{logger: l, fields: merged}
+}
+
+func (l *fieldLogger) Trace(msg string, fields ...map[string]interface{}) {
+	l.logger.Trace(msg, l.merge(fields))
+}
+
+func (l *fieldLogger) Debug(msg string, fields ...map[string]interface{}) {
+	l.logger.Debug(msg, l.merge(fields))
+}
+
+func (l *fieldLogger) Info(msg string, fields ...map[string]interface{}) {
+	l.logger.Info(msg, l.merge(fields))
+}
+
+func (l *fieldLogger) Warn(msg string, fields ...map[string]interface{}) {
+	l.logger.Warn(msg, l.merge(fields))
+}
+
+func (l *fieldLogger) Error(msg string, fields ...map[string]interface{}) {
+	l.logger.Error(msg, l.merge(fields))
+}
+
+// merge returns the fields of the logger overridden by the fields of a single call.
+func (l *fieldLogger) merge(fields []map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(l.fields))
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+
+	for _, f := range fields {
+		for key, value := range f {
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
+
 // NoOp returns a no-operation Logger which doesn't perform any logging operations.
 func NoOp() Logger {
 	return zerologadapter.New(zerolog.Nop())
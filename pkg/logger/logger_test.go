@@ -2,6 +2,7 @@ package logger_test
 
 import (
 	"bytes"
+	"errors"
 	"strings"
 	"testing"
 
@@ -91,3 +92,52 @@ func TestNew(t *testing.T) {
 		t.Errorf("New() returned nil")
 	}
 }
+
+func TestSetLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := logger.New(logger.WithWriters(buf), logger.WithLogLevel("info"))
+
+	log.Debug("hidden message")
+	if err := logger.SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel() returned %v", err)
+	}
+	defer logger.SetLevel("info")
+
+	log.Debug("shown message")
+	output := buf.String()
+	if strings.Contains(output, "hidden message") || !strings.Contains(output, "shown message") {
+		t.Errorf("Expected only messages after SetLevel() to be shown, got %v", output)
+	}
+
+	if level := logger.GetLevel(); level != "debug" {
+		t.Errorf("GetLevel() returned %s, expected debug", level)
+	}
+
+	if err := logger.SetLevel("verbose"); !errors.Is(err, logger.ErrInvalidLogLevel) {
+		t.Errorf("Expected ErrInvalidLogLevel, got %v", err)
+	}
+
+	if level := logger.GetLevel(); level != "debug" {
+		t.Errorf("Expected an invalid level to be ignored, got %s", level)
+	}
+}
+
+func TestWithFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	parent := logger.WithFields(logger.New(logger.WithWriters(buf)), map[string]interface{}{"service": "database", "phase": "infra"})
+	child := logger.WithFields(parent, map[string]interface{}{"phase": "core"})
+
+	child.Info("test message", map[string]interface{}{"attempt": 2})
+	output := buf.String()
+	for _, field := range []string{`"service":"database"`, `"phase":"core"`, `"attempt":2`} {
+		if !strings.Contains(output, field) {
+			t.Errorf("Expected %s in output: %v", field, output)
+		}
+	}
+
+	buf.Reset()
+	parent.Info("test message", map[string]interface{}{"service": "queue"})
+	if output := buf.String(); !strings.Contains(output, `"service":"queue"`) || !strings.Contains(output, `"phase":"infra"`) {
+		t.Errorf("Expected the fields of the call to take precedence, got %v", output)
+	}
+}
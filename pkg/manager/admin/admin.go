@@ -0,0 +1,231 @@
+// Package admin provides an HTTP handler for on-call debugging of a ServiceManager. It
+// exposes control over the services and profiling data, so it must only be served on an
+// internal address. Like net/http/pprof, which it serves the profiles with, importing the
+// package registers the pprof handlers on http.DefaultServeMux; do not serve the default mux
+// on a public address.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/flowshot-io/x/pkg/logger"
+	"github.com/flowshot-io/x/pkg/manager"
+)
+
+type (
+	// Manager is the part of a ServiceManager controlled by the handler.
+	Manager interface {
+		Status() []manager.ServiceStatus
+		StopService(ctx context.Context, name manager.ServiceName) error
+		RestartService(ctx context.Context, name manager.ServiceName) error
+	}
+
+	// ServiceInfo is the status of a service as listed by the handler. Uptime is the time
+	// the service has been running for, if it is running.
+	ServiceInfo struct {
+		manager.ServiceStatus
+		Uptime string `json:"uptime,omitempty"`
+	}
+
+	// LogLevel is the body of the log level endpoint.
+	LogLevel struct {
+		Level string `json:"level"`
+	}
+
+	// Option configures the handler.
+	Option func(*handler)
+
+	handler struct {
+		manager Manager
+		logger  logger.Logger
+		clock   manager.Clock
+	}
+
+	errorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// WithLogger sets the logger recording the actions taken through the handler (defaults to
+// logger.NoOp()).
+func WithLogger(l logger.Logger) Option {
+	return func(h *handler) {
+		h.logger = l
+	}
+}
+
+// WithClock sets the clock the uptime of services is measured with (defaults to
+// manager.RealClock()).
+func WithClock(c manager.Clock) Option {
+	return func(h *handler) {
+		h.clock = c
+	}
+}
+
+// NewHandler returns an HTTP handler serving:
+//
+//	GET  /services                list the services with their state, uptime, restarts and last error
+//	POST /services/{name}/restart restart a single service
+//	POST /services/{name}/stop    stop a single service
+//	GET  /loglevel                report the level of logs, as LogLevel
+//	POST /loglevel                change the level of logs, given as LogLevel
+//	     /debug/pprof/            profiles of net/http/pprof, for go tool pprof
+//
+// Mount it with http.StripPrefix to serve it under a prefix. The handler does not use
+// http.DefaultServeMux, but see the package documentation for the pprof handlers registered
+// there.
+func NewHandler(m Manager, opts ...Option) http.Handler {
+	h := &handler{
+		manager: m,
+		logger:  logger.NoOp(),
+		clock:   manager.RealClock(),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services", h.services)
+	mux.HandleFunc("/services/", h.control)
+	mux.HandleFunc("/loglevel", h.logLevel)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// services lists the status of all services.
+func (h *handler) services(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	now := h.clock.Now()
+	statuses := h.manager.Status()
+	services := make([]ServiceInfo, len(statuses))
+	for i, status := range statuses {
+		services[i] = ServiceInfo{ServiceStatus: status}
+		if status.State == manager.StateRunning && !status.StartedAt.IsZero() {
+			services[i].Uptime = now.Sub(status.StartedAt).String()
+		}
+	}
+
+	writeJSON(w, http.StatusOK, services)
+}
+
+// control restarts or stops the service named in the path.
+func (h *handler) control(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/services/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	name, action := manager.ServiceName(path[:i]), path[i+1:]
+
+	var control func(ctx context.Context, name manager.ServiceName) error
+	switch action {
+	case "restart":
+		control = h.manager.RestartService
+	case "stop":
+		control = h.manager.StopService
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	h.logger.Warn("Service control requested through the admin handler", map[string]interface{}{
+		"service":    string(name),
+		"action":     action,
+		"remoteAddr": r.RemoteAddr,
+	})
+
+	if err := control(r.Context(), name); err != nil {
+		writeError(w, controlStatus(err), err)
+		return
+	}
+
+	for _, status := range h.manager.Status() {
+		if status.Name == name {
+			writeJSON(w, http.StatusOK, status)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logLevel reports or changes the level of logs.
+func (h *handler) logLevel(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var level LogLevel
+		if err := json.NewDecoder(r.Body).Decode(&level); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := logger.SetLevel(level.Level); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		h.logger.Warn("Log level changed through the admin handler", map[string]interface{}{
+			"level":      level.Level,
+			"remoteAddr": r.RemoteAddr,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, LogLevel{Level: logger.GetLevel()})
+}
+
+// controlStatus returns the HTTP status reporting the error of a control operation.
+func controlStatus(err error) int {
+	switch {
+	case errors.Is(err, manager.ErrUnknownService):
+		return http.StatusNotFound
+	case errors.Is(err, manager.ErrServiceRequired), errors.Is(err, manager.ErrDependencyNotRunning):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// allowMethod responds with 405 unless the request uses one of the methods.
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,142 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/logger"
+	"github.com/flowshot-io/x/pkg/manager"
+	"github.com/flowshot-io/x/pkg/manager/admin"
+	"github.com/flowshot-io/x/pkg/manager/managertest"
+)
+
+type serviceInfo struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Uptime   string `json:"uptime"`
+	Restarts int    `json:"restarts"`
+	Error    string `json:"error"`
+}
+
+func serve(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func TestHandler(t *testing.T) {
+	clock := managertest.NewFakeClock(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	database := managertest.NewService("database")
+	api := managertest.NewService("api")
+
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp(), Clock: clock})
+	serviceManager.AddContext("database", database)
+	serviceManager.AddContext("api", api, manager.DependsOn("database"))
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+	defer serviceManager.Stop()
+
+	handler := admin.NewHandler(serviceManager, admin.WithClock(clock))
+	clock.Advance(time.Minute)
+
+	t.Run("List Services", func(t *testing.T) {
+		response := serve(handler, http.MethodGet, "/services", "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", response.Code)
+		}
+
+		var services []serviceInfo
+		if err := json.NewDecoder(response.Body).Decode(&services); err != nil {
+			t.Fatalf("Failed to decode services: %v", err)
+		}
+
+		if len(services) != 2 || services[0].Name != "api" || services[0].State != "running" || services[0].Uptime != "1m0s" {
+			t.Errorf("Expected api to be running for a minute, got %+v", services)
+		}
+	})
+
+	t.Run("Restart Service", func(t *testing.T) {
+		response := serve(handler, http.MethodPost, "/services/database/restart", "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body)
+		}
+
+		if database.Starts() != 2 || !database.Running() {
+			t.Errorf("Expected database to be restarted")
+		}
+	})
+
+	t.Run("Stop Required Service", func(t *testing.T) {
+		if response := serve(handler, http.MethodPost, "/services/database/stop", ""); response.Code != http.StatusConflict {
+			t.Errorf("Expected 409, got %d", response.Code)
+		}
+	})
+
+	t.Run("Stop Service", func(t *testing.T) {
+		if response := serve(handler, http.MethodPost, "/services/api/stop", ""); response.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", response.Code, response.Body)
+		}
+
+		if api.Running() {
+			t.Errorf("Expected api to be stopped")
+		}
+	})
+
+	t.Run("Invalid Requests", func(t *testing.T) {
+		if response := serve(handler, http.MethodPost, "/services/unknown/restart", ""); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an unknown service, got %d", response.Code)
+		}
+
+		if response := serve(handler, http.MethodPost, "/services/api/pause", ""); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an unknown action, got %d", response.Code)
+		}
+
+		response := serve(handler, http.MethodGet, "/services/api/restart", "")
+		if response.Code != http.StatusMethodNotAllowed || response.Header().Get("Allow") != http.MethodPost {
+			t.Errorf("Expected 405 allowing POST, got %d", response.Code)
+		}
+	})
+
+	t.Run("Log Level", func(t *testing.T) {
+		defer logger.SetLevel(logger.GetLevel())
+
+		response := serve(handler, http.MethodPost, "/loglevel", `{"level":"debug"}`)
+		if response.Code != http.StatusOK || logger.GetLevel() != "debug" {
+			t.Errorf("Expected the log level to be changed, got %d: %s", response.Code, response.Body)
+		}
+
+		if response := serve(handler, http.MethodPost, "/loglevel", `{"level":"verbose"}`); response.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an invalid level, got %d", response.Code)
+		}
+
+		var level admin.LogLevel
+		json.NewDecoder(serve(handler, http.MethodGet, "/loglevel", "").Body).Decode(&level)
+		if level.Level != "debug" {
+			t.Errorf("Expected log level debug, got %s", level.Level)
+		}
+	})
+
+	t.Run("Profiling", func(t *testing.T) {
+		if response := serve(handler, http.MethodGet, "/debug/pprof/", ""); response.Code != http.StatusOK {
+			t.Errorf("Expected 200 for the pprof index, got %d", response.Code)
+		}
+
+		if response := serve(handler, http.MethodGet, "/debug/pprof/goroutine?debug=1", ""); response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "goroutine") {
+			t.Errorf("Expected the goroutine profile, got %d", response.Code)
+		}
+
+		if response := serve(handler, http.MethodGet, "/debug/pprof/unknown", ""); response.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for an unknown profile, got %d", response.Code)
+		}
+
+		if response := serve(handler, http.MethodGet, "/debug/pprof/profile?seconds=1", ""); response.Code != http.StatusOK || response.Body.Len() == 0 {
+			t.Errorf("Expected a CPU profile, got %d", response.Code)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package manager
+
+import "time"
+
+type (
+	// Clock provides the time to the manager, so tests can control the restart backoff,
+	// the health probes and the timestamps of events. Timeouts of Start and Stop operations
+	// always use the real time.
+	Clock interface {
+		Now() time.Time
+		NewTimer(d time.Duration) Timer
+		NewTicker(d time.Duration) Ticker
+	}
+
+	// Timer delivers the time of a Clock on its channel once. A timer which is no longer
+	// waited for must be stopped.
+	Timer interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	// Ticker delivers ticks of a Clock on its channel until it is stopped.
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	realClock struct{}
+
+	realTimer struct {
+		timer *time.Timer
+	}
+
+	realTicker struct {
+		ticker *time.Ticker
+	}
+)
+
+// RealClock returns the Clock backed by the time package.
+func RealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time { return time.Now() }
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{ticker: time.NewTicker(d)}
+}
+
+func (t realTimer) C() <-chan time.Time { return t.timer.C }
+func (t realTimer) Stop()               { t.timer.Stop() }
+
+func (t realTicker) C() <-chan time.Time { return t.ticker.C }
+func (t realTicker) Stop()               { t.ticker.Stop() }
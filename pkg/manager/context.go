@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+type (
+	// ContextService defines the interface for a service whose Start and Stop methods
+	// honour the cancellation and deadline of a context.
+	ContextService interface {
+		Start(ctx context.Context) error
+		Stop(ctx context.Context) error
+	}
+
+	// TimeoutError is returned when a service does not finish starting or stopping in time.
+	TimeoutError struct {
+		Service   ServiceName
+		Operation string
+		Timeout   time.Duration
+	}
+
+	// serviceAdapter adapts a Service to the ContextService interface.
+	serviceAdapter struct {
+		service Service
+	}
+
+	// contextServiceAdapter adapts a ContextService to the Service interface.
+	contextServiceAdapter struct {
+		service ContextService
+	}
+)
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("service %s did not %s within %s", e.Service, e.Operation, e.Timeout)
+	}
+
+	return fmt.Sprintf("service %s did not %s before the deadline", e.Service, e.Operation)
+}
+
+// Is reports whether the target is context.DeadlineExceeded.
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// FromService adapts a Service to the ContextService interface.
+// The returned service gives up waiting when the context is done, but the underlying
+// Start or Stop call keeps running in the background until it returns. Services which
+// also offer StartContext and StopContext, such as ServiceManager, are passed the context.
+func FromService(s Service) ContextService {
+	if a, ok := s.(*contextServiceAdapter); ok {
+		return a.service
+	}
+
+	return &serviceAdapter{service: s}
+}
+
+// ToService adapts a ContextService to the Service interface, calling it with a
+// background context.
+func ToService(s ContextService) Service {
+	if a, ok := s.(*serviceAdapter); ok {
+		return a.service
+	}
+
+	return &contextServiceAdapter{service: s}
+}
+
+func (a *serviceAdapter) Start(ctx context.Context) error {
+	if l, ok := a.service.(contextLifecycle); ok {
+		return l.StartContext(ctx)
+	}
+
+	return callContext(ctx, a.service.Start)
+}
+
+func (a *serviceAdapter) Stop(ctx context.Context) error {
+	if l, ok := a.service.(contextLifecycle); ok {
+		return l.StopContext(ctx)
+	}
+
+	return callContext(ctx, a.service.Stop)
+}
+
+func (a *contextServiceAdapter) Start() error {
+	return a.service.Start(context.Background())
+}
+
+func (a *contextServiceAdapter) Stop() error {
+	return a.service.Stop(context.Background())
+}
+
+// underlying returns the service as it was added to the manager, so optional interfaces
+// can be detected on services added through Add.
+func underlying(s ContextService) interface{} {
+	if a, ok := s.(*serviceAdapter); ok {
+		return a.service
+	}
+
+	return s
+}
+
+// callContext runs fn and returns its error, or the context error if the context is done first.
+func callContext(ctx context.Context, fn func() error) error {
+	_, err := callAbandonable(ctx, fn)
+	return err
+}
+
+// callAbandonable runs fn and returns its error, or the context error if the context is done
+// first. In the latter case fn keeps running, and the returned channel receives its error once
+// it returns. A panic in fn is recovered and returned as a *PanicError.
+func callAbandonable(ctx context.Context, fn func() error) (<-chan error, error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if value := recover(); value != nil {
+				done <- &PanicError{Value: value, Stack: debug.Stack()}
+			}
+		}()
+
+		done <- fn()
+	}()
+
+	select {
+	case err := <-done:
+		return nil, err
+	case <-ctx.Done():
+		// Prefer the result if fn returned at the same time.
+		select {
+		case err := <-done:
+			return nil, err
+		default:
+			return done, ctx.Err()
+		}
+	}
+}
+
+// callWithTimeout runs a lifecycle operation of a service, bounded by the context and the
+// timeout if it is positive. A missed deadline is reported as a *TimeoutError and a panic as a
+// *PanicError, both naming the service.
+func callWithTimeout(ctx context.Context, name ServiceName, operation string, timeout time.Duration, fn func(ctx context.Context) error) error {
+	_, err := callAbandonableWithTimeout(ctx, name, operation, timeout, fn)
+	return err
+}
+
+// callAbandonableWithTimeout is like callWithTimeout, but when the operation is given up on
+// it also returns a channel receiving the error of the operation once it returns.
+func callAbandonableWithTimeout(ctx context.Context, name ServiceName, operation string, timeout time.Duration, fn func(ctx context.Context) error) (<-chan error, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	late, err := callAbandonable(ctx, func() error {
+		return fn(ctx)
+	})
+
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+		return late, &TimeoutError{Service: name, Operation: operation, Timeout: timeout}
+	}
+
+	// Panics recovered by a nested call, e.g. in a serviceAdapter, do not know the service.
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) && panicErr.Service == "" {
+		panicErr.Service = name
+		panicErr.Op = operation
+	}
+
+	return late, err
+}
+
+// startFunc returns the Start method of the service. Services added through Add are started
+// directly, so the result of a Start call which was given up on can still be observed.
+func startFunc(s ContextService) func(ctx context.Context) error {
+	if a, ok := s.(*serviceAdapter); ok {
+		if l, ok := a.service.(contextLifecycle); ok {
+			return l.StartContext
+		}
+
+		return func(context.Context) error {
+			return a.service.Start()
+		}
+	}
+
+	return s.Start
+}
@@ -0,0 +1,182 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnknownService is returned when an operation names a service that was not added.
+	ErrUnknownService = errors.New("unknown service")
+	// ErrServiceStarted is returned when adding a service whose name is taken by a started
+	// service, and by services which are started while they are already running.
+	ErrServiceStarted = errors.New("service already started")
+	// ErrDependencyNotRunning is returned when starting a service whose dependencies are not running.
+	ErrDependencyNotRunning = errors.New("dependency not running")
+	// ErrServiceRequired is returned when stopping or removing a service other services depend on.
+	ErrServiceRequired = errors.New("service required by other services")
+)
+
+// Remove drains and stops the service if it was started and removes it from the ServiceManager.
+// It returns an error if other services depend on the service.
+func (sm *ServiceManager) Remove(ctx context.Context, name ServiceName) error {
+	sm.control.Lock()
+	defer sm.control.Unlock()
+
+	entry, err := sm.entry(name)
+	if err != nil {
+		return err
+	}
+
+	if dependents := sm.dependents(name, false); len(dependents) > 0 {
+		return fmt.Errorf("%w: service %s is required by %v", ErrServiceRequired, name, dependents)
+	}
+
+	ctx, cancel := sm.withStopTimeout(ctx)
+	defer cancel()
+
+	sm.drain(ctx, map[ServiceName]*serviceEntry{name: entry})
+	if err := sm.stopService(ctx, entry); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	delete(sm.services, name)
+	sm.mu.Unlock()
+	sm.forgetHealth(name)
+	entry.close()
+
+	sm.logger.Info("Service removed from service manager", entry.logFields())
+	return nil
+}
+
+// StartService starts a single service without touching the others. A service which
+// exited on its own is stopped before it is started again. It returns an error if any of
+// the dependencies of the service is not running.
+func (sm *ServiceManager) StartService(ctx context.Context, name ServiceName) error {
+	sm.control.Lock()
+	defer sm.control.Unlock()
+
+	entry, err := sm.entry(name)
+	if err != nil {
+		return err
+	}
+
+	if entry.isStarted() && entry.snapshot().State == StateRunning {
+		return nil
+	}
+
+	return sm.restartService(ctx, entry)
+}
+
+// StopService drains and stops a single service without touching the others. It returns an error if
+// any started service depends on the service.
+func (sm *ServiceManager) StopService(ctx context.Context, name ServiceName) error {
+	sm.control.Lock()
+	defer sm.control.Unlock()
+
+	entry, err := sm.entry(name)
+	if err != nil {
+		return err
+	}
+
+	if dependents := sm.dependents(name, true); len(dependents) > 0 {
+		return fmt.Errorf("%w: service %s is required by %v", ErrServiceRequired, name, dependents)
+	}
+
+	ctx, cancel := sm.withStopTimeout(ctx)
+	defer cancel()
+
+	sm.drain(ctx, map[ServiceName]*serviceEntry{name: entry})
+	err = sm.stopService(ctx, entry)
+	sm.forgetHealth(name)
+	return err
+}
+
+// RestartService stops a single service and starts it again. Services depending on it are
+// left running and have to cope with the short interruption.
+func (sm *ServiceManager) RestartService(ctx context.Context, name ServiceName) error {
+	sm.control.Lock()
+	defer sm.control.Unlock()
+
+	entry, err := sm.entry(name)
+	if err != nil {
+		return err
+	}
+
+	return sm.restartService(ctx, entry)
+}
+
+// restartService stops the service if it was started and starts it again once all of its
+// dependencies are running.
+func (sm *ServiceManager) restartService(ctx context.Context, entry *serviceEntry) error {
+	services := sm.entries()
+	for _, dep := range entry.dependencies {
+		depEntry, ok := services[dep]
+		if !ok {
+			return sm.startFailed(entry, fmt.Errorf("%w: service %s depends on %s", ErrMissingDependency, entry.name, dep))
+		}
+		if !depEntry.isStarted() || depEntry.snapshot().State != StateRunning {
+			return sm.startFailed(entry, fmt.Errorf("%w: service %s depends on %s", ErrDependencyNotRunning, entry.name, dep))
+		}
+	}
+
+	stopCtx, cancel := sm.withStopTimeout(ctx)
+	err := sm.stopService(stopCtx, entry)
+	cancel()
+	if err != nil {
+		return err
+	}
+	sm.forgetHealth(entry.name)
+
+	if sm.startTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sm.startTimeout)
+		defer cancel()
+	}
+
+	late, err := sm.startService(ctx, entry)
+	if late != nil {
+		go sm.settleStart(entry, late)
+	}
+
+	return err
+}
+
+// entry returns the service with the given name.
+func (sm *ServiceManager) entry(name ServiceName) (*serviceEntry, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	entry, ok := sm.services[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, name)
+	}
+
+	return entry, nil
+}
+
+// dependents returns the names of the services depending on the given service, optionally
+// only the started ones, ordered by name.
+func (sm *ServiceManager) dependents(name ServiceName, startedOnly bool) []ServiceName {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var dependents []ServiceName
+	for _, entry := range sm.services {
+		if startedOnly && !entry.isStarted() {
+			continue
+		}
+
+		for _, dep := range entry.dependencies {
+			if dep == name {
+				dependents = append(dependents, entry.name)
+				break
+			}
+		}
+	}
+
+	sortServiceNames(dependents)
+	return dependents
+}
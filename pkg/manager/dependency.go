@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrMissingDependency is returned when a service depends on a service that was not added.
+	ErrMissingDependency = errors.New("missing dependency")
+	// ErrDependencyCycle is returned when service dependencies form a cycle.
+	ErrDependencyCycle = errors.New("dependency cycle")
+)
+
+// startWaves groups the services into waves which can be started concurrently.
+// Every service is placed in a later wave than all of its dependencies, so starting the
+// waves in order and stopping them in reverse order respects the declared dependencies.
+// Dependencies which are not among the services are left to startPlan, which starts them
+// in an earlier phase.
+func startWaves(services map[ServiceName]*serviceEntry) ([][]ServiceName, error) {
+	remaining := make(map[ServiceName]int, len(services))
+	dependents := make(map[ServiceName][]ServiceName, len(services))
+
+	for name, entry := range services {
+		remaining[name] = 0
+		for _, dep := range entry.dependencies {
+			if _, ok := services[dep]; !ok {
+				continue
+			}
+
+			remaining[name]++
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	var wave []ServiceName
+	for name, count := range remaining {
+		if count == 0 {
+			wave = append(wave, name)
+		}
+	}
+
+	var waves [][]ServiceName
+	placed := 0
+	for len(wave) > 0 {
+		sortServiceNames(wave)
+		waves = append(waves, wave)
+		placed += len(wave)
+
+		var next []ServiceName
+		for _, name := range wave {
+			for _, dependent := range dependents[name] {
+				remaining[dependent]--
+				if remaining[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		wave = next
+	}
+
+	if placed != len(services) {
+		var cycle []ServiceName
+		for name, count := range remaining {
+			if count > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sortServiceNames(cycle)
+
+		return nil, fmt.Errorf("%w between services %v", ErrDependencyCycle, cycle)
+	}
+
+	return waves, nil
+}
+
+func sortServiceNames(names []ServiceName) {
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+}
@@ -0,0 +1,77 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultDrainTimeout is the time services have to drain by default.
+const DefaultDrainTimeout = 10 * time.Second
+
+// Drainer is implemented by services which can stop accepting new work and finish the work
+// in flight before they are stopped. Drain returns once no work is in flight, or when the
+// context is done with an error describing the work still in flight.
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+
+// drain drains the started services implementing Drainer concurrently before they are
+// stopped, giving up at the drain deadline.
+func (sm *ServiceManager) drain(ctx context.Context, services map[ServiceName]*serviceEntry) {
+	ctx, cancel := context.WithTimeout(ctx, sm.drainTimeout)
+	defer cancel()
+
+	names := make([]ServiceName, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sortServiceNames(names)
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		// Copy variables to prevent data race
+		entry := services[name]
+		if _, ok := underlying(entry.service).(Drainer); !ok || !entry.isStarted() {
+			continue
+		}
+
+		sm.spawn(&wg, func() {
+			sm.drainService(ctx, entry)
+		})
+	}
+
+	wg.Wait()
+}
+
+// drainService drains a single service. Work still in flight at the deadline is logged and
+// the service is stopped regardless.
+func (sm *ServiceManager) drainService(ctx context.Context, entry *serviceEntry) {
+	drainer, ok := underlying(entry.service).(Drainer)
+	if !ok {
+		return
+	}
+
+	entry.lifecycle.Lock()
+	defer entry.lifecycle.Unlock()
+
+	began := time.Now()
+	sm.transition(entry, StateDraining, nil)
+	opCtx, end := sm.instrumentation.StartOperation(ctx, entry.name, OpDrain)
+	err := callWithTimeout(opCtx, entry.name, OpDrain, 0, drainer.Drain)
+	end(err)
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		sm.logger.Error("Error draining service", entry.logFields(errorFields(err), durationField(began)))
+		return
+	}
+
+	if err != nil {
+		sm.logger.Warn("Service still has work in flight at the drain deadline", entry.logFields(errorFields(err), durationField(began)))
+		return
+	}
+
+	sm.logger.Info("Service drained successfully", entry.logFields(durationField(began)))
+}
@@ -0,0 +1,162 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// OpStart is the operation of starting a service.
+	OpStart = "start"
+	// OpStop is the operation of stopping a service.
+	OpStop = "stop"
+	// OpDrain is the operation of draining a service before it is stopped.
+	OpDrain = "drain"
+	// OpRollback is the operation of stopping a started service after another service
+	// failed to start.
+	OpRollback = "rollback"
+)
+
+type (
+	// ServiceError describes a lifecycle operation which failed for a service.
+	ServiceError struct {
+		Service ServiceName
+		Op      string
+		Err     error
+	}
+
+	// PanicError reports a panic recovered from a lifecycle operation of a service,
+	// e.g. a Start or Stop call. Stack holds the stack trace of the panicking goroutine.
+	PanicError struct {
+		Service ServiceName
+		Op      string
+		Value   interface{}
+		Stack   []byte
+	}
+
+	// MultiError reports every service which failed during a Start or Stop operation.
+	// errors.Is and errors.As match an error if they match any of the service errors.
+	MultiError struct {
+		Errors []*ServiceError
+	}
+)
+
+func (e *ServiceError) Error() string {
+	switch e.Op {
+	case OpStart:
+		return fmt.Sprintf("error starting service %s: %v", e.Service, e.Err)
+	case OpStop:
+		return fmt.Sprintf("error stopping service %s: %v", e.Service, e.Err)
+	case OpRollback:
+		return fmt.Sprintf("error stopping service %s during rollback: %v", e.Service, e.Err)
+	}
+
+	return fmt.Sprintf("error during %s of service %s: %v", e.Op, e.Service, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("service %s panicked during %s: %v", e.Service, e.Op, e.Value)
+}
+
+// Unwrap returns the panic value if it is an error, e.g. for a runtime error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+func (e *MultiError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("%d services failed: %s", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Is reports whether any of the service errors matches the target.
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first service error matching the target and sets the target to it.
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Services returns the names of the failed services in the order they were reported.
+func (e *MultiError) Services() []ServiceName {
+	names := make([]ServiceName, len(e.Errors))
+	for i, err := range e.Errors {
+		names[i] = err.Service
+	}
+
+	return names
+}
+
+// errorOrNil returns the aggregated errors, or nil if there are none.
+func errorOrNil(errs []*ServiceError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &MultiError{Errors: errs}
+}
+
+// asServiceError returns the error as a *ServiceError, wrapping it if necessary.
+func asServiceError(name ServiceName, op string, err error) *ServiceError {
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) && serviceErr.Service == name {
+		return serviceErr
+	}
+
+	return &ServiceError{Service: name, Op: op, Err: err}
+}
+
+// errorFields returns the log fields describing the error, including the stack trace of a
+// recovered panic.
+func errorFields(err error) map[string]interface{} {
+	fields := map[string]interface{}{
+		"error": err.Error(),
+	}
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		fields["stack"] = string(panicErr.Stack)
+	}
+
+	return fields
+}
+
+// sortServiceErrors orders the errors by service name, so concurrent failures are reported
+// in a stable order.
+func sortServiceErrors(errs []*ServiceError) {
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Service < errs[j].Service
+	})
+}
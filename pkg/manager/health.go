@@ -0,0 +1,228 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHealthCheckInterval is the time between health probes by default.
+	DefaultHealthCheckInterval = 10 * time.Second
+	// DefaultHealthCheckTimeout is the time a single health probe may take by default.
+	DefaultHealthCheckTimeout = 5 * time.Second
+)
+
+type (
+	// HealthChecker is implemented by services which can report whether they are healthy.
+	// HealthCheck is probed periodically while the service is running and returns an error
+	// describing the problem when the service is unhealthy.
+	HealthChecker interface {
+		HealthCheck(ctx context.Context) error
+	}
+
+	// HealthStatus is the result of the latest health probe of a service.
+	HealthStatus struct {
+		Healthy   bool      `json:"healthy"`
+		Error     string    `json:"error,omitempty"`
+		CheckedAt time.Time `json:"checkedAt"`
+	}
+
+	// HealthReport aggregates the health of all services.
+	// Healthy is true when no probed service is unhealthy; Ready is true when additionally
+	// all services have started and the manager is not stopping. Draining is true while
+	// the services finish their work in flight before they are stopped.
+	HealthReport struct {
+		Healthy  bool                         `json:"healthy"`
+		Ready    bool                         `json:"ready"`
+		Draining bool                         `json:"draining"`
+		Services map[ServiceName]HealthStatus `json:"services"`
+	}
+
+	// healthState holds the health of the running services.
+	healthState struct {
+		mu       sync.RWMutex
+		ready    bool
+		draining bool
+		services map[ServiceName]HealthStatus
+	}
+)
+
+// Health returns the aggregated health of all services as of their latest probes.
+func (sm *ServiceManager) Health() HealthReport {
+	sm.health.mu.RLock()
+	defer sm.health.mu.RUnlock()
+
+	report := HealthReport{
+		Healthy:  true,
+		Services: make(map[ServiceName]HealthStatus, len(sm.health.services)),
+	}
+
+	for name, status := range sm.health.services {
+		report.Services[name] = status
+		if !status.Healthy {
+			report.Healthy = false
+		}
+	}
+
+	report.Ready = report.Healthy && sm.health.ready
+	report.Draining = sm.health.draining
+	return report
+}
+
+// HealthCheck returns an error naming the unhealthy services, if any. It makes the health
+// of a ServiceManager added to another one part of the health of its parent.
+func (sm *ServiceManager) HealthCheck(ctx context.Context) error {
+	report := sm.Health()
+
+	var unhealthy []ServiceName
+	for name, status := range report.Services {
+		if !status.Healthy {
+			unhealthy = append(unhealthy, name)
+		}
+	}
+
+	if len(unhealthy) == 0 {
+		return nil
+	}
+
+	sortServiceNames(unhealthy)
+	return fmt.Errorf("unhealthy services: %v", unhealthy)
+}
+
+// LivenessHandler returns an HTTP handler reporting whether all services are healthy.
+// It responds with 200 when healthy and 503 otherwise, with the HealthReport as body.
+func (sm *ServiceManager) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := sm.Health()
+		writeHealthReport(w, report, report.Healthy)
+	})
+}
+
+// ReadinessHandler returns an HTTP handler reporting whether the services are ready to
+// receive traffic. It responds with 200 when ready and 503 otherwise, with the
+// HealthReport as body.
+func (sm *ServiceManager) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := sm.Health()
+		writeHealthReport(w, report, report.Ready)
+	})
+}
+
+// HealthHandler returns an HTTP handler serving the liveness handler on /healthz and the
+// readiness handler on /readyz, as expected by Kubernetes probes.
+func (sm *ServiceManager) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", sm.LivenessHandler())
+	mux.Handle("/readyz", sm.ReadinessHandler())
+	return mux
+}
+
+// setReady marks the manager as ready or not ready to receive traffic.
+func (sm *ServiceManager) setReady(ready bool) {
+	sm.health.mu.Lock()
+	defer sm.health.mu.Unlock()
+
+	sm.health.ready = ready
+}
+
+// setDraining marks the manager as draining its services.
+func (sm *ServiceManager) setDraining(draining bool) {
+	sm.health.mu.Lock()
+	defer sm.health.mu.Unlock()
+
+	sm.health.draining = draining
+}
+
+// resetHealth forgets the health of all services.
+func (sm *ServiceManager) resetHealth() {
+	sm.health.mu.Lock()
+	defer sm.health.mu.Unlock()
+
+	sm.health.ready = false
+	sm.health.services = make(map[ServiceName]HealthStatus)
+}
+
+// probeHealth probes the health of all services periodically until stopping is closed.
+func (sm *ServiceManager) probeHealth(stopping <-chan struct{}) {
+	ticker := sm.clock.NewTicker(sm.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		sm.checkHealth(stopping)
+
+		select {
+		case <-ticker.C():
+		case <-stopping:
+			return
+		}
+	}
+}
+
+// forgetHealth forgets the health of a service which is no longer running.
+func (sm *ServiceManager) forgetHealth(name ServiceName) {
+	sm.health.mu.Lock()
+	defer sm.health.mu.Unlock()
+
+	delete(sm.health.services, name)
+}
+
+// checkHealth probes every running service implementing HealthChecker concurrently.
+func (sm *ServiceManager) checkHealth(stopping <-chan struct{}) {
+	entries := make(map[ServiceName]*serviceEntry)
+
+	sm.mu.RLock()
+	for name, entry := range sm.services {
+		if entry.snapshot().State != StateRunning {
+			continue
+		}
+		if _, ok := underlying(entry.service).(HealthChecker); ok {
+			entries[name] = entry
+		}
+	}
+	sm.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, entry := range entries {
+		name := name
+		entry := entry
+		checker := underlying(entry.service).(HealthChecker)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := callWithTimeout(context.Background(), name, "pass health check", sm.healthTimeout, checker.HealthCheck)
+
+			status := HealthStatus{Healthy: err == nil, CheckedAt: sm.clock.Now()}
+			if err != nil {
+				status.Error = err.Error()
+				sm.logger.Warn("Service health check failed", entry.logFields(errorFields(err)))
+			}
+
+			sm.health.mu.Lock()
+			defer sm.health.mu.Unlock()
+
+			// Results arriving after the manager or the service started stopping are stale.
+			if !isClosed(stopping) && entry.isStarted() {
+				sm.health.services[name] = status
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if ok {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	json.NewEncoder(w).Encode(report)
+}
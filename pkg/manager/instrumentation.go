@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Instrumentation observes the lifecycle of the services of a manager.
+type Instrumentation interface {
+	// StartOperation is called when a lifecycle operation of a service begins. The returned
+	// context is passed to the operation, and the returned function is called with the
+	// outcome of the operation once it ends.
+	StartOperation(ctx context.Context, service ServiceName, op string) (context.Context, func(err error))
+	// ObserveTransition records that a service moved to a new lifecycle state.
+	ObserveTransition(service ServiceName, from, to State)
+	// ObserveRestart records a restart of a service by its supervisor.
+	ObserveRestart(service ServiceName)
+}
+
+// NoOpInstrumentation returns an Instrumentation which discards everything.
+func NoOpInstrumentation() Instrumentation {
+	return noOpInstrumentation{}
+}
+
+// MultiInstrumentation returns an Instrumentation which passes everything to all of the
+// instrumentations, e.g. to record both metrics and traces.
+func MultiInstrumentation(instrumentations ...Instrumentation) Instrumentation {
+	return multiInstrumentation(instrumentations)
+}
+
+type (
+	noOpInstrumentation struct{}
+
+	multiInstrumentation []Instrumentation
+)
+
+func (noOpInstrumentation) StartOperation(ctx context.Context, service ServiceName, op string) (context.Context, func(err error)) {
+	return ctx, func(err error) {}
+}
+func (noOpInstrumentation) ObserveTransition(service ServiceName, from, to State) {}
+func (noOpInstrumentation) ObserveRestart(service ServiceName)                    {}
+
+func (m multiInstrumentation) StartOperation(ctx context.Context, service ServiceName, op string) (context.Context, func(err error)) {
+	ends := make([]func(err error), len(m))
+	for i, instrumentation := range m {
+		ctx, ends[i] = instrumentation.StartOperation(ctx, service, op)
+	}
+
+	return ctx, func(err error) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
+
+func (m multiInstrumentation) ObserveTransition(service ServiceName, from, to State) {
+	for _, instrumentation := range m {
+		instrumentation.ObserveTransition(service, from, to)
+	}
+}
+
+func (m multiInstrumentation) ObserveRestart(service ServiceName) {
+	for _, instrumentation := range m {
+		instrumentation.ObserveRestart(service)
+	}
+}
+
+// PrometheusInstrumentation implements Instrumentation with Prometheus collectors.
+type PrometheusInstrumentation struct {
+	operations *prometheus.HistogramVec
+	errors     *prometheus.CounterVec
+	states     *prometheus.GaugeVec
+	failures   *prometheus.CounterVec
+	restarts   *prometheus.CounterVec
+}
+
+// NewPrometheusInstrumentation creates the service manager collectors under the namespace
+// and registers them with the registerer (prometheus.DefaultRegisterer if nil).
+func NewPrometheusInstrumentation(registerer prometheus.Registerer, namespace string) (*PrometheusInstrumentation, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	m := &PrometheusInstrumentation{
+		operations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "manager",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of service start and stop operations.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"service", "operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "manager",
+			Name:      "operation_errors_total",
+			Help:      "Number of failed service start and stop operations.",
+		}, []string{"service", "operation"}),
+		states: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "manager",
+			Name:      "service_state",
+			Help:      "Current lifecycle state of services, 1 for the current state and 0 otherwise.",
+		}, []string{"service", "state"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "manager",
+			Name:      "service_failures_total",
+			Help:      "Number of times services entered the failed state.",
+		}, []string{"service"}),
+		restarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "manager",
+			Name:      "service_restarts_total",
+			Help:      "Number of service restarts by their supervisor.",
+		}, []string{"service"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.operations, m.errors, m.states, m.failures, m.restarts} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// StartOperation records the duration and outcome of the operation once it ends.
+func (m *PrometheusInstrumentation) StartOperation(ctx context.Context, service ServiceName, op string) (context.Context, func(err error)) {
+	began := time.Now()
+
+	return ctx, func(err error) {
+		m.operations.WithLabelValues(string(service), op).Observe(time.Since(began).Seconds())
+		if err != nil {
+			m.errors.WithLabelValues(string(service), op).Inc()
+		}
+	}
+}
+
+// ObserveTransition updates the state gauges of the service and counts failures.
+func (m *PrometheusInstrumentation) ObserveTransition(service ServiceName, from, to State) {
+	for state := range stateNames {
+		value := 0.0
+		if state == to {
+			value = 1
+		}
+		m.states.WithLabelValues(string(service), state.String()).Set(value)
+	}
+
+	if to == StateFailed {
+		m.failures.WithLabelValues(string(service)).Inc()
+	}
+}
+
+// ObserveRestart counts a restart of the service.
+func (m *PrometheusInstrumentation) ObserveRestart(service ServiceName) {
+	m.restarts.WithLabelValues(string(service)).Inc()
+}
+
+// TracingInstrumentation implements Instrumentation with OpenTelemetry spans around the
+// lifecycle operations of services. Context-aware services receive the span in the
+// context passed to Start and Stop.
+type TracingInstrumentation struct {
+	tracer trace.Tracer
+}
+
+// NewTracingInstrumentation creates an Instrumentation starting spans with the tracer, e.g.
+// otel.Tracer("manager").
+func NewTracingInstrumentation(tracer trace.Tracer) *TracingInstrumentation {
+	return &TracingInstrumentation{tracer: tracer}
+}
+
+// StartOperation starts a span named after the operation, ended with its outcome.
+func (t *TracingInstrumentation) StartOperation(ctx context.Context, service ServiceName, op string) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, "service."+op, trace.WithAttributes(
+		attribute.String("manager.service", string(service)),
+	))
+
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// ObserveTransition does nothing; transitions are covered by the spans of the operations.
+func (t *TracingInstrumentation) ObserveTransition(service ServiceName, from, to State) {}
+
+// ObserveRestart does nothing; restarts are covered by the spans of the operations.
+func (t *TracingInstrumentation) ObserveRestart(service ServiceName) {}
@@ -0,0 +1,94 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type (
+	// FileLock is a Lock backed by an advisory lock on a file, shared by the processes on
+	// one host. The operating system releases the lock when its process exits.
+	FileLock struct {
+		path string
+	}
+
+	fileLease struct {
+		mu   sync.Mutex
+		path string
+		file *os.File
+	}
+)
+
+// NewFileLock creates a Lock on the file at path, which is created if it does not exist.
+// The file is never removed, as removing it would let two processes lock different files.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Acquire locks the file without waiting for another process to unlock it.
+func (l *FileLock) Acquire(ctx context.Context) (Lease, error) {
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file %s: %w", l.path, err)
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &fileLease{path: l.path, file: file}, nil
+}
+
+// TTL returns 0, as the lock is held until it is released or the process exits.
+func (l *FileLock) TTL() time.Duration {
+	return 0
+}
+
+// ExpiresAt returns the zero time, as the lease does not expire.
+func (l *fileLease) ExpiresAt() time.Time {
+	return time.Time{}
+}
+
+// Renew verifies the locked file is still the one at the path of the lock.
+func (l *fileLease) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("%w: %s", ErrLeaseLost, l.path)
+	}
+
+	locked, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	current, err := os.Stat(l.path)
+	if err != nil || !os.SameFile(locked, current) {
+		return fmt.Errorf("%w: lock file %s was replaced", ErrLeaseLost, l.path)
+	}
+
+	return nil
+}
+
+// Release unlocks the file.
+func (l *fileLease) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+
+	return err
+}
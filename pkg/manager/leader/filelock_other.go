@@ -0,0 +1,18 @@
+//go:build !unix
+
+package leader
+
+import (
+	"errors"
+	"os"
+)
+
+var errFileLockUnsupported = errors.New("file locks are not supported on this platform")
+
+func lockFile(file *os.File) error {
+	return errFileLockUnsupported
+}
+
+func unlockFile(file *os.File) error {
+	return errFileLockUnsupported
+}
@@ -0,0 +1,349 @@
+// Package leader provides a service which runs another service only on the replica holding
+// a lock, e.g. for schedulers which must run exactly once.
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/logger"
+	"github.com/flowshot-io/x/pkg/manager"
+)
+
+const (
+	// DefaultRetryInterval is the time between attempts to acquire the lock by default.
+	DefaultRetryInterval = 5 * time.Second
+	// DefaultRenewInterval is the time between renewals of the lease by default. Locks whose
+	// leases expire within MinRenewsPerTTL renew intervals default to a fraction of their TTL.
+	DefaultRenewInterval = 10 * time.Second
+	// MinRenewsPerTTL is the number of renewals a lease must have the chance of before it
+	// expires, so a single slow or failed renewal does not cost the lease.
+	MinRenewsPerTTL = 3
+)
+
+type (
+	// Service campaigns for a lock and runs the wrapped service while it holds the lease.
+	// The wrapped service is stopped when the lease is lost, and started again once the
+	// lock is acquired again.
+	//
+	// A wrapped service which fails to start or, if it is manager.Waitable, exits on its
+	// own ends the Service: the lease is released and the error is reported through Done,
+	// so the ServiceManager can restart it according to its restart policy.
+	Service struct {
+		lock          Lock
+		service       manager.ContextService
+		logger        logger.Logger
+		clock         manager.Clock
+		retryInterval time.Duration
+		renewInterval time.Duration
+
+		mu      sync.Mutex
+		cancel  context.CancelFunc
+		exited  chan struct{}
+		done    chan error
+		lease   Lease
+		leading bool
+	}
+
+	// Option configures a Service.
+	Option func(*Service)
+)
+
+// WithLogger sets the logger of the service (defaults to logger.New()).
+func WithLogger(l logger.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock sets the clock timing the retries and renewals (defaults to manager.RealClock()).
+func WithClock(c manager.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
+}
+
+// WithRetryInterval sets the time between attempts to acquire the lock.
+func WithRetryInterval(d time.Duration) Option {
+	return func(s *Service) {
+		s.retryInterval = d
+	}
+}
+
+// WithRenewInterval sets the time between renewals of the lease. It must not exceed the TTL
+// of the lock divided by MinRenewsPerTTL.
+func WithRenewInterval(d time.Duration) Option {
+	return func(s *Service) {
+		s.renewInterval = d
+	}
+}
+
+// NewService creates a Service running service while it holds the lock.
+// It returns an error if the renew interval leaves too little room to renew a lease of the
+// lock before it expires.
+func NewService(lock Lock, service manager.Service, opts ...Option) (*Service, error) {
+	s := &Service{
+		lock:          lock,
+		service:       manager.FromService(service),
+		retryInterval: DefaultRetryInterval,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.retryInterval <= 0 {
+		return nil, fmt.Errorf("invalid retry interval: %s", s.retryInterval)
+	}
+
+	if s.renewInterval < 0 {
+		return nil, fmt.Errorf("invalid renew interval: %s", s.renewInterval)
+	}
+
+	ttl := lock.TTL()
+	maxRenewInterval := ttl / MinRenewsPerTTL
+	if s.renewInterval == 0 {
+		s.renewInterval = DefaultRenewInterval
+		if ttl > 0 && s.renewInterval > maxRenewInterval {
+			s.renewInterval = maxRenewInterval
+		}
+	}
+
+	if ttl > 0 && (s.renewInterval > maxRenewInterval || s.renewInterval <= 0) {
+		return nil, fmt.Errorf("renew interval %s is too long for a lease TTL of %s, it must not exceed %s",
+			s.renewInterval, ttl, maxRenewInterval)
+	}
+
+	if s.logger == nil {
+		s.logger = logger.New()
+	}
+
+	if s.clock == nil {
+		s.clock = manager.RealClock()
+	}
+
+	return s, nil
+}
+
+// Start begins campaigning for the lock in the background.
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return manager.ErrServiceStarted
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.exited = make(chan struct{})
+	s.done = make(chan error, 1)
+
+	go s.campaign(runCtx, s.exited, s.done)
+	return nil
+}
+
+// Stop ends the campaign, stops the wrapped service if it is running and releases the lease.
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, exited := s.cancel, s.exited
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-exited:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return s.resign(ctx)
+}
+
+// Done returns the channel receiving the error which ended the service.
+func (s *Service) Done() <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.done
+}
+
+// IsLeader reports whether the service holds the lease and runs the wrapped service.
+func (s *Service) IsLeader() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.leading
+}
+
+// campaign acquires the lock and leads until the context is cancelled or leading fails.
+func (s *Service) campaign(ctx context.Context, exited chan<- struct{}, done chan<- error) {
+	defer close(exited)
+
+	for {
+		lease, err := s.lock.Acquire(ctx)
+		if err == nil {
+			err = s.lead(ctx, lease)
+			if ctx.Err() != nil {
+				return
+			}
+
+			var ended *endedError
+			if errors.As(err, &ended) {
+				if ended.err != nil {
+					done <- ended.err
+				}
+				close(done)
+				return
+			}
+
+			s.logger.Warn("Lost leadership", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else if ctx.Err() != nil {
+			return
+		} else if !errors.Is(err, ErrLockHeld) {
+			s.logger.Warn("Error acquiring leader lock", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
+		timer := s.clock.NewTimer(s.retryInterval)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// endedError reports that the wrapped service failed to start or exited, which ends the
+// campaign. err is nil if the wrapped service exited cleanly.
+type endedError struct {
+	err error
+}
+
+func (e *endedError) Error() string {
+	if e.err == nil {
+		return "service exited"
+	}
+
+	return e.err.Error()
+}
+
+// lead runs the wrapped service while the lease is renewed. It returns when the context is
+// cancelled, leaving the wrapped service to be stopped by Stop, or once the wrapped service
+// was stopped and the lease released after leading failed.
+func (s *Service) lead(ctx context.Context, lease Lease) error {
+	s.mu.Lock()
+	s.lease = lease
+	s.leading = true
+	s.mu.Unlock()
+
+	s.logger.Info("Acquired leadership, starting service")
+	if err := s.service.Start(ctx); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+
+		s.resign(context.Background())
+		return &endedError{err: err}
+	}
+
+	var exits <-chan error
+	if w, ok := waitable(s.service); ok {
+		exits = w.Done()
+	}
+
+	ticker := s.clock.NewTicker(s.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-exits:
+			ticker.Stop()
+			s.resign(context.Background())
+			return &endedError{err: err}
+		case <-ticker.C():
+			// Without a confirmed lease another replica may take over any moment.
+			if err := s.renew(ctx, lease); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				ticker.Stop()
+				s.resign(context.Background())
+				return err
+			}
+		}
+	}
+}
+
+// renew renews the lease, giving up one renew interval before it expires if the renewal is
+// not confirmed by then, so the wrapped service is stopped before another replica can take
+// over the lease.
+func (s *Service) renew(ctx context.Context, lease Lease) error {
+	expiresAt := lease.ExpiresAt()
+	if expiresAt.IsZero() {
+		return lease.Renew(ctx)
+	}
+
+	renewCtx, cancel := context.WithDeadline(ctx, expiresAt.Add(-s.renewInterval))
+	defer cancel()
+
+	// A renewal which ignores its context must not keep the wrapped service running.
+	result := make(chan error, 1)
+	go func() {
+		result <- lease.Renew(renewCtx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-renewCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: lease about to expire before it was renewed", ErrLeaseLost)
+	}
+}
+
+// resign stops the wrapped service if it is running and releases the lease.
+func (s *Service) resign(ctx context.Context) error {
+	s.mu.Lock()
+	lease, leading := s.lease, s.leading
+	s.lease, s.leading = nil, false
+	s.mu.Unlock()
+
+	if !leading {
+		return nil
+	}
+
+	err := s.service.Stop(ctx)
+	if releaseErr := lease.Release(ctx); releaseErr != nil && !errors.Is(releaseErr, ErrLeaseLost) && err == nil {
+		err = releaseErr
+	}
+
+	s.logger.Info("Resigned leadership")
+	return err
+}
+
+// waitable returns the wrapped service as a manager.Waitable, if it is one.
+func waitable(s manager.ContextService) (manager.Waitable, bool) {
+	if w, ok := s.(manager.Waitable); ok {
+		return w, true
+	}
+
+	w, ok := manager.ToService(s).(manager.Waitable)
+	return w, ok
+}
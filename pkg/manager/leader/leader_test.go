@@ -0,0 +1,351 @@
+package leader_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/artifactservice/artifactservicetest"
+	"github.com/flowshot-io/x/pkg/logger"
+	"github.com/flowshot-io/x/pkg/manager"
+	"github.com/flowshot-io/x/pkg/manager/leader"
+	"github.com/flowshot-io/x/pkg/manager/managertest"
+)
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.lock")
+	lock := leader.NewFileLock(path)
+
+	lease, err := lock.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	if _, err := lock.Acquire(context.Background()); !errors.Is(err, leader.ErrLockHeld) {
+		t.Fatalf("Expected ErrLockHeld, got %v", err)
+	}
+
+	if err := lease.Renew(context.Background()); err != nil {
+		t.Errorf("Expected the lease to be renewed, got %v", err)
+	}
+
+	if err := lease.Release(context.Background()); err != nil {
+		t.Fatalf("Failed to release lease: %v", err)
+	}
+
+	lease, err = lock.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to acquire released lock: %v", err)
+	}
+	defer lease.Release(context.Background())
+
+	os.Remove(path)
+	if err := lease.Renew(context.Background()); !errors.Is(err, leader.ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost after the lock file was removed, got %v", err)
+	}
+}
+
+func TestStorageLock(t *testing.T) {
+	store := artifactservicetest.NewStorage()
+	first, err := leader.NewStorageLock(store, "locks", "scheduler", "replica-1", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create lock: %v", err)
+	}
+
+	second, err := leader.NewStorageLock(store, "locks", "scheduler", "replica-2", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create lock: %v", err)
+	}
+
+	if _, err := leader.NewStorageLock(store, "locks", "scheduler", "", time.Minute); err == nil {
+		t.Errorf("Expected a lock without owner to be rejected")
+	}
+
+	lease, err := first.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	if _, err := second.Acquire(context.Background()); !errors.Is(err, leader.ErrLockHeld) {
+		t.Fatalf("Expected ErrLockHeld, got %v", err)
+	}
+
+	if err := lease.Release(context.Background()); err != nil {
+		t.Fatalf("Failed to release lease: %v", err)
+	}
+
+	taken, err := second.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to acquire released lock: %v", err)
+	}
+
+	if err := lease.Renew(context.Background()); !errors.Is(err, leader.ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost after the lock was taken over, got %v", err)
+	}
+
+	taken.Release(context.Background())
+}
+
+func TestFailover(t *testing.T) {
+	clock := managertest.NewFakeClock(time.Now())
+	recorder := managertest.NewRecorder()
+	path := filepath.Join(t.TempDir(), "scheduler.lock")
+
+	newReplica := func(name manager.ServiceName) (*leader.Service, *manager.ServiceManager) {
+		s, err := leader.NewService(leader.NewFileLock(path),
+			manager.ToService(managertest.NewService(name, managertest.WithRecorder(recorder))),
+			leader.WithLogger(logger.NoOp()), leader.WithClock(clock), leader.WithRetryInterval(time.Second),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create service: %v", err)
+		}
+
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.AddContext("scheduler", s)
+		return s, serviceManager
+	}
+
+	first, firstManager := newReplica("first")
+	second, secondManager := newReplica("second")
+
+	if err := firstManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+	waitFor(t, first.IsLeader)
+
+	if err := secondManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+	defer secondManager.Stop()
+
+	// The renew ticker of the leader and the retry of the follower.
+	clock.BlockUntil(2)
+	if second.IsLeader() {
+		t.Fatalf("Expected only one leader")
+	}
+
+	if err := firstManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+
+	clock.Advance(time.Second)
+	waitFor(t, second.IsLeader)
+
+	recorder.AssertCalls(t, "first:start", "first:stop", "second:start")
+}
+
+// flakyLock is a Lock whose leases fail to renew once lost is set, and whose renewals block
+// while stalled is open. Leases expire after ttl unless it is 0.
+type flakyLock struct {
+	mu        sync.Mutex
+	lost      bool
+	stalled   chan struct{}
+	ttl       time.Duration
+	expiresAt time.Time
+}
+
+func (l *flakyLock) Acquire(ctx context.Context) (leader.Lease, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ttl > 0 {
+		l.expiresAt = time.Now().Add(l.ttl)
+	}
+	return l, nil
+}
+
+func (l *flakyLock) TTL() time.Duration {
+	return l.ttl
+}
+
+func (l *flakyLock) ExpiresAt() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.expiresAt
+}
+
+func (l *flakyLock) Renew(ctx context.Context) error {
+	l.mu.Lock()
+	stalled := l.stalled
+	l.mu.Unlock()
+
+	// A stalled renewal ignores its context, like a storage call which never returns.
+	if stalled != nil {
+		<-stalled
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lost {
+		l.lost = false
+		return leader.ErrLeaseLost
+	}
+
+	if l.ttl > 0 {
+		l.expiresAt = time.Now().Add(l.ttl)
+	}
+	return nil
+}
+
+func (l *flakyLock) Release(ctx context.Context) error {
+	return nil
+}
+
+func (l *flakyLock) stall() func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stalled = make(chan struct{})
+	return func() { close(l.stalled) }
+}
+
+func (l *flakyLock) lose() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lost = true
+}
+
+func TestLeaseLoss(t *testing.T) {
+	clock := managertest.NewFakeClock(time.Now())
+	lock := &flakyLock{}
+	scheduler := managertest.NewService("scheduler")
+	s, err := leader.NewService(lock, manager.ToService(scheduler),
+		leader.WithLogger(logger.NoOp()), leader.WithClock(clock),
+		leader.WithRetryInterval(time.Second), leader.WithRenewInterval(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	waitFor(t, scheduler.Running)
+	clock.BlockUntil(1)
+
+	lock.lose()
+	clock.Advance(time.Second)
+	waitFor(t, func() bool { return scheduler.Stops() == 1 })
+
+	// The lock is acquired again after the retry interval.
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	waitFor(t, func() bool { return scheduler.Starts() == 2 && scheduler.Running() })
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Failed to stop service: %v", err)
+	}
+
+	if scheduler.Running() || s.IsLeader() {
+		t.Errorf("Expected the scheduler to be stopped with the leader service")
+	}
+}
+
+func TestServiceExit(t *testing.T) {
+	failure := errors.New("connection lost")
+	scheduler := managertest.NewService("scheduler")
+	s, err := leader.NewService(&flakyLock{}, manager.ToService(scheduler), leader.WithLogger(logger.NoOp()))
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	waitFor(t, scheduler.Running)
+	scheduler.Exit(failure)
+
+	select {
+	case err := <-s.Done():
+		if !errors.Is(err, failure) {
+			t.Errorf("Expected the exit of the scheduler to be reported, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the exit of the scheduler to be reported")
+	}
+
+	if s.IsLeader() {
+		t.Errorf("Expected leadership to be resigned")
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	clock := managertest.NewFakeClock(time.Now())
+	lock := &flakyLock{ttl: 300 * time.Millisecond}
+	scheduler := managertest.NewService("scheduler")
+	s, err := leader.NewService(lock, manager.ToService(scheduler),
+		leader.WithLogger(logger.NoOp()), leader.WithClock(clock),
+		leader.WithRetryInterval(time.Second), leader.WithRenewInterval(100*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create service: %v", err)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	waitFor(t, scheduler.Running)
+	clock.BlockUntil(1)
+
+	// The scheduler is stopped before the lease expires, even though the renewal never returns.
+	resume := lock.stall()
+	defer resume()
+
+	expiresAt := lock.ExpiresAt()
+	clock.Advance(100 * time.Millisecond)
+	waitFor(t, func() bool { return scheduler.Stops() == 1 })
+
+	if stoppedAt := time.Now(); !stoppedAt.Before(expiresAt) {
+		t.Errorf("Expected the scheduler to be stopped before the lease expired, %s late", stoppedAt.Sub(expiresAt))
+	}
+
+	if s.IsLeader() {
+		t.Errorf("Expected leadership to be resigned")
+	}
+}
+
+func TestRenewInterval(t *testing.T) {
+	scheduler := manager.ToService(managertest.NewService("scheduler"))
+
+	lock, err := leader.NewStorageLock(artifactservicetest.NewStorage(), "locks", "scheduler", "replica-1", 9*time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create lock: %v", err)
+	}
+
+	// The default renew interval is shortened to fit the TTL.
+	if _, err := leader.NewService(lock, scheduler); err != nil {
+		t.Errorf("Expected the default renew interval to fit the TTL, got %v", err)
+	}
+
+	if _, err := leader.NewService(lock, scheduler, leader.WithRenewInterval(5*time.Second)); err == nil {
+		t.Errorf("Expected a renew interval above a third of the TTL to be rejected")
+	}
+
+	if _, err := leader.NewService(lock, scheduler, leader.WithRenewInterval(3*time.Second)); err != nil {
+		t.Errorf("Expected a renew interval of a third of the TTL to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flowshot-io/polystore/pkg/types"
+	"github.com/flowshot-io/x/pkg/artifactservice"
+)
+
+var (
+	// ErrLockHeld is matched by errors returned when the lock is held by another owner.
+	ErrLockHeld = errors.New("lock is held by another owner")
+	// ErrLeaseLost is matched by errors returned when a lease is no longer held.
+	ErrLeaseLost = errors.New("lease is no longer held")
+)
+
+type (
+	// Lock is a backend for leader election. Only one owner holds the lock at a time.
+	Lock interface {
+		// Acquire takes the lock, returning an error matching ErrLockHeld if another
+		// owner holds it.
+		Acquire(ctx context.Context) (Lease, error)
+		// TTL returns how long a lease stays valid without being renewed, or 0 if leases
+		// do not expire.
+		TTL() time.Duration
+	}
+
+	// Lease is a claim on a Lock.
+	Lease interface {
+		// Renew confirms the lease is still held and extends it if it expires, returning an
+		// error matching ErrLeaseLost if it is not.
+		Renew(ctx context.Context) error
+		// Release gives up the lease.
+		Release(ctx context.Context) error
+		// ExpiresAt returns the time the lease expires unless renewed, or the zero time if
+		// it does not expire.
+		ExpiresAt() time.Time
+	}
+
+	// StorageLock is a Lock backed by a lock object in storage, shared by all replicas with
+	// access to the storage. Leases expire unless they are renewed within their TTL.
+	//
+	// Storage offers no conditional writes, so replicas acquiring a free lock at the same
+	// time may each read back their own lock object and both believe they hold the lease.
+	// The replica whose object was overwritten finds out on its next renewal, so two leaders
+	// can overlap for up to one renew interval. Wrapped services must tolerate this.
+	StorageLock struct {
+		locker *artifactservice.Locker
+		name   string
+		owner  string
+		ttl    time.Duration
+	}
+
+	storageLease struct {
+		lease *artifactservice.Lease
+	}
+)
+
+// NewStorageLock creates a Lock on the lock object of name under the working directory of the
+// storage, held by owner for the ttl (defaults to artifactservice.DefaultLeaseTTL). Owners
+// must be unique, e.g. the hostname of the replica.
+func NewStorageLock(store types.Storage, workingDir string, name string, owner string, ttl time.Duration) (*StorageLock, error) {
+	if store == nil {
+		return nil, fmt.Errorf("store is required")
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("lock name is required")
+	}
+
+	if owner == "" {
+		return nil, fmt.Errorf("lock owner is required")
+	}
+
+	if ttl < 0 {
+		return nil, fmt.Errorf("invalid lease TTL: %s", ttl)
+	}
+
+	if ttl == 0 {
+		ttl = artifactservice.DefaultLeaseTTL
+	}
+
+	return &StorageLock{
+		locker: artifactservice.NewLocker(store, workingDir),
+		name:   name,
+		owner:  owner,
+		ttl:    ttl,
+	}, nil
+}
+
+// TTL returns how long a lease stays valid without being renewed.
+func (l *StorageLock) TTL() time.Duration {
+	return l.ttl
+}
+
+// Acquire takes the lease on the lock object unless another owner holds a live lease.
+// A concurrent Acquire by another owner may succeed as well; see StorageLock.
+func (l *StorageLock) Acquire(ctx context.Context) (Lease, error) {
+	lease, err := l.locker.Acquire(ctx, l.name, l.owner, l.ttl)
+	if errors.Is(err, artifactservice.ErrLeaseHeld) {
+		return nil, fmt.Errorf("%w: %v", ErrLockHeld, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &storageLease{lease: lease}, nil
+}
+
+// Renew extends the lease by its TTL.
+func (l *storageLease) Renew(ctx context.Context) error {
+	return leaseError(l.lease.Renew(ctx))
+}
+
+// Release deletes the lock object unless another owner took it over.
+func (l *storageLease) Release(ctx context.Context) error {
+	return leaseError(l.lease.Release(ctx))
+}
+
+// ExpiresAt returns the time the lease expires unless renewed.
+func (l *storageLease) ExpiresAt() time.Time {
+	return l.lease.ExpiresAt()
+}
+
+// leaseError converts a lost lease of the artifact service into ErrLeaseLost.
+func leaseError(err error) error {
+	if errors.Is(err, artifactservice.ErrLeaseLost) {
+		return fmt.Errorf("%w: %v", ErrLeaseLost, err)
+	}
+
+	return err
+}
@@ -0,0 +1,44 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/flowshot-io/x/pkg/logger"
+)
+
+// LoggerAware is implemented by services which log through the logger of the manager.
+// SetLogger is called when the service is added, with a child logger adding the service
+// and phase fields to every entry.
+type LoggerAware interface {
+	SetLogger(l logger.Logger)
+}
+
+// setLogger hands a LoggerAware service its child logger.
+func (sm *ServiceManager) setLogger(entry *serviceEntry) {
+	if aware, ok := underlying(entry.service).(LoggerAware); ok {
+		aware.SetLogger(logger.WithFields(sm.logger, entry.logFields()))
+	}
+}
+
+// logFields returns the log fields identifying the service, merged with the given fields.
+func (e *serviceEntry) logFields(fields ...map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{
+		"service": string(e.name),
+		"phase":   e.phase.Name,
+	}
+
+	for _, f := range fields {
+		for key, value := range f {
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
+
+// durationField returns the log field holding the time passed since began.
+func durationField(began time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"duration": time.Since(began).String(),
+	}
+}
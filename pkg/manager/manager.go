@@ -1,12 +1,15 @@
 package manager
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/flowshot-io/x/pkg/logger"
-	"golang.org/x/sync/errgroup"
 )
 
 type (
@@ -15,9 +18,16 @@ type (
 
 	// ServiceController defines the interface for a service manager.
 	ServiceController interface {
-		Add(name ServiceName, s Service) error
+		Add(name ServiceName, s Service, opts ...ServiceOption) error
+		AddContext(name ServiceName, s ContextService, opts ...ServiceOption) error
+		Remove(ctx context.Context, name ServiceName) error
 		Start() error
+		StartContext(ctx context.Context) error
 		Stop() error
+		StopContext(ctx context.Context) error
+		StartService(ctx context.Context, name ServiceName) error
+		StopService(ctx context.Context, name ServiceName) error
+		RestartService(ctx context.Context, name ServiceName) error
 	}
 
 	// Service defines the interface for a service with Start and Stop methods.
@@ -26,20 +36,110 @@ type (
 		Stop() error
 	}
 
+	// ServiceOption defines a function which configures how a service is managed.
+	ServiceOption func(*serviceEntry)
+
+	// Options struct defines the service manager options.
+	// StartTimeout bounds a whole Start operation and StopTimeout a whole Stop operation (0 means no limit).
+	// ShutdownTimeout bounds the graceful shutdown performed by Run (defaults to DefaultShutdownTimeout).
+	// Signals sets the signals which make Run shut down (defaults to SIGINT and SIGTERM).
+	// ExitFunc is called by Run when a second signal forces an exit (defaults to os.Exit).
+	// HealthCheckInterval sets the time between health probes (defaults to DefaultHealthCheckInterval).
+	// HealthCheckTimeout bounds a single health probe (defaults to DefaultHealthCheckTimeout).
+	// Sequential starts and stops the services of a wave one at a time in order of their
+	// names instead of concurrently, so logs and events are reproducible between runs.
+	// Instrumentation observes the lifecycle of the services (defaults to NoOpInstrumentation).
+	// DrainTimeout bounds how long services implementing Drainer may drain before they are
+	// stopped (defaults to DefaultDrainTimeout).
+	// Clock provides the time for restart backoffs, health probes and event timestamps
+	// (defaults to RealClock).
 	Options struct {
-		Logger logger.Logger
+		Logger              logger.Logger
+		StartTimeout        time.Duration
+		StopTimeout         time.Duration
+		ShutdownTimeout     time.Duration
+		Signals             []os.Signal
+		ExitFunc            func(code int)
+		HealthCheckInterval time.Duration
+		HealthCheckTimeout  time.Duration
+		Sequential          bool
+		Instrumentation     Instrumentation
+		DrainTimeout        time.Duration
+		Clock               Clock
 	}
 
 	// ServiceManager is responsible for managing multiple services.
 	ServiceManager struct {
-		mu        sync.RWMutex
-		services  map[ServiceName]Service
-		opMutex   sync.Mutex
-		operating bool
-		logger    logger.Logger
+		mu              sync.RWMutex
+		services        map[ServiceName]*serviceEntry
+		control         sync.Mutex
+		active          bool
+		opMutex         sync.Mutex
+		operating       bool
+		logger          logger.Logger
+		startTimeout    time.Duration
+		stopTimeout     time.Duration
+		shutdownTimeout time.Duration
+		signals         []os.Signal
+		exit            func(code int)
+		failed          chan error
+		stopping        chan struct{}
+		running         bool
+		supervised      bool
+		events          eventBus
+		health          healthState
+		healthInterval  time.Duration
+		healthTimeout   time.Duration
+		sequential      bool
+		instrumentation Instrumentation
+		drainTimeout    time.Duration
+		clock           Clock
+	}
+
+	// serviceEntry holds a service together with its management options.
+	serviceEntry struct {
+		name          ServiceName
+		service       ContextService
+		dependencies  []ServiceName
+		phase         Phase
+		startTimeout  time.Duration
+		stopTimeout   time.Duration
+		restartPolicy RestartPolicy
+		status        serviceStatus
+		unsubscribe   func()
+
+		// lifecycle serializes Start and Stop calls on the service.
+		lifecycle sync.Mutex
+
+		// supervision guards started and stopping, which is closed when the manager stops
+		// supervising the service.
+		supervision sync.Mutex
+		started     bool
+		stopping    chan struct{}
 	}
 )
 
+// DependsOn declares services which must be started before the service and stopped after it.
+func DependsOn(names ...ServiceName) ServiceOption {
+	return func(e *serviceEntry) {
+		e.dependencies = append(e.dependencies, names...)
+	}
+}
+
+// WithStartTimeout limits how long the service may take to start.
+func WithStartTimeout(d time.Duration) ServiceOption {
+	return func(e *serviceEntry) {
+		e.startTimeout = d
+	}
+}
+
+// WithStopTimeout limits how long the service may take to stop.
+func WithStopTimeout(d time.Duration) ServiceOption {
+	return func(e *serviceEntry) {
+		e.stopTimeout = d
+	}
+}
+
 // New creates and returns a new ServiceManager.
 func New(opts *Options) *ServiceManager {
 	if opts == nil {
@@ -47,104 +147,260 @@ func New(opts *Options) *ServiceManager {
 	}
 
 	if opts.Logger == nil {
-		opts.Logger = logger.New(nil)
+		opts.Logger = logger.New()
+	}
+
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = DefaultShutdownTimeout
+	}
+
+	if len(opts.Signals) == 0 {
+		opts.Signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	if opts.ExitFunc == nil {
+		opts.ExitFunc = os.Exit
+	}
+
+	if opts.HealthCheckInterval <= 0 {
+		opts.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+
+	if opts.HealthCheckTimeout <= 0 {
+		opts.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = DefaultDrainTimeout
+	}
+
+	if opts.Instrumentation == nil {
+		opts.Instrumentation = NoOpInstrumentation()
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = RealClock()
 	}
 
 	return &ServiceManager{
-		services: make(map[ServiceName]Service),
-		logger:   opts.Logger,
+		services:        make(map[ServiceName]*serviceEntry),
+		logger:          opts.Logger,
+		startTimeout:    opts.StartTimeout,
+		stopTimeout:     opts.StopTimeout,
+		shutdownTimeout: opts.ShutdownTimeout,
+		signals:         opts.Signals,
+		exit:            opts.ExitFunc,
+		failed:          make(chan error, 1),
+		events:          eventBus{subscribers: make(map[int]chan Event)},
+		health:          healthState{services: make(map[ServiceName]HealthStatus)},
+		healthInterval:  opts.HealthCheckInterval,
+		healthTimeout:   opts.HealthCheckTimeout,
+		sequential:      opts.Sequential,
+		instrumentation: opts.Instrumentation,
+		drainTimeout:    opts.DrainTimeout,
+		clock:           opts.Clock,
 	}
 }
 
 // Add adds a service to the ServiceManager.
+// Dependencies declared with DependsOn are validated when the services are started.
+// If the manager is running, the service is started right away.
 // It returns an error if a Start or Stop operation is currently in progress.
-func (sm *ServiceManager) Add(name ServiceName, s Service) error {
+func (sm *ServiceManager) Add(name ServiceName, s Service, opts ...ServiceOption) error {
+	return sm.AddContext(name, FromService(s), opts...)
+}
+
+// AddContext adds a context-aware service to the ServiceManager. A service implementing
+// LoggerAware is handed its child logger.
+// If the manager is running, the service is started right away; a service which fails to
+// start stays added, so it can be started again with StartService or removed with Remove.
+// It returns an error if a Start or Stop operation is currently in progress, or if a
+// started service with the same name exists.
+func (sm *ServiceManager) AddContext(name ServiceName, s ContextService, opts ...ServiceOption) error {
 	sm.opMutex.Lock()
 	if sm.operating {
 		sm.opMutex.Unlock()
 		sm.logger.Warn("Cannot add service during start or stop operation", map[string]interface{}{
-			"serviceName": name,
+			"service": string(name),
 		})
 		return errors.New("cannot add service during start or stop operation")
 	}
 	sm.opMutex.Unlock()
 
+	entry := &serviceEntry{name: name, service: s, phase: PhaseCore}
+	entry.status.since = sm.clock.Now()
+	for _, opt := range opts {
+		opt(entry)
+	}
+
+	sm.control.Lock()
+	defer sm.control.Unlock()
+
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	sm.services[name] = s
-	sm.logger.Info("Service added to service manager", map[string]interface{}{
-		"serviceName": name,
-	})
+	existing, ok := sm.services[name]
+	if ok && existing.isStarted() {
+		sm.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrServiceStarted, name)
+	}
+	sm.services[name] = entry
+	sm.mu.Unlock()
 
-	return nil
+	if ok {
+		existing.close()
+	}
+	sm.forwardEvents(entry)
+	sm.setLogger(entry)
+
+	sm.logger.Info("Service added to service manager", entry.logFields(map[string]interface{}{
+		"dependencies": entry.dependencies,
+	}))
+
+	if !sm.active {
+		return nil
+	}
+
+	return sm.restartService(context.Background(), entry)
 }
 
-// Start starts all services concurrently.
-// If any service fails to start, it stops the already started services and returns the error.
+// Start starts all services in dependency order.
+// It is equivalent to StartContext with a background context.
 func (sm *ServiceManager) Start() error {
+	return sm.StartContext(context.Background())
+}
+
+// StartContext starts all services in dependency order.
+// Services are started in waves; every service in a wave is started concurrently once all
+// services of the previous waves are running. If any service fails to start or the context
+// is done first, it cancels the starts still in progress, stops the already started services
+// in reverse order and returns the error. A service whose start was given up on but which
+// starts after all is stopped as soon as its start returns.
+// Services which are already running are left as they are.
+func (sm *ServiceManager) StartContext(ctx context.Context) error {
+	return sm.start(ctx, 0)
+}
+
+// start starts all services as StartContext does. A positive rollbackTimeout bounds the
+// stopping of the already started services after a failed start as a whole, on top of the
+// stop timeout of each service.
+func (sm *ServiceManager) start(ctx context.Context, rollbackTimeout time.Duration) error {
 	sm.logger.Info("Starting services...")
+	began := time.Now()
+	sm.control.Lock()
+	defer sm.control.Unlock()
+
 	sm.opMutex.Lock()
 	sm.operating = true
+	// Retire the health prober of a previous start; this start launches its own.
+	if sm.stopping != nil {
+		close(sm.stopping)
+	}
+	sm.stopping = make(chan struct{})
+	stopping := sm.stopping
 	sm.opMutex.Unlock()
 
+	// Forget a failure and health left over from a previous run.
+	select {
+	case <-sm.failed:
+	default:
+	}
+	sm.resetHealth()
+
 	defer func() {
 		sm.opMutex.Lock()
 		sm.operating = false
 		sm.opMutex.Unlock()
 	}()
 
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-
-	var startedServices []Service
-	var startedServicesMutex sync.Mutex
-
-	var g errgroup.Group
-	for name, s := range sm.services {
-		// Copy variables to prevent data race
-		s := s
-		name := name
-
-		g.Go(func() error {
-			err := s.Start()
-			if err != nil {
-				sm.logger.Error(fmt.Sprintf("Error starting service %s", name), map[string]interface{}{
-					"error": err.Error(),
-				})
-				return fmt.Errorf("error starting service %s: %w", name, err)
-			}
-
-			startedServicesMutex.Lock()
-			startedServices = append(startedServices, s)
-			startedServicesMutex.Unlock()
-
-			sm.logger.Info(fmt.Sprintf("Service %s started successfully", name))
-			return nil
+	services := sm.entries()
+	plan, err := startPlan(services)
+	if err != nil {
+		sm.logger.Error("Error resolving service dependencies", map[string]interface{}{
+			"error": err.Error(),
 		})
+		return err
 	}
 
-	if err := g.Wait(); err != nil {
-		// Stop the already started services
-		for _, s := range startedServices {
-			s.Stop()
-		}
+	if sm.startTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sm.startTimeout)
+		defer cancel()
+	}
 
-		sm.logger.Error("Error during starting services", map[string]interface{}{
-			"error": err.Error(),
+	var started [][]ServiceName
+	for _, phase := range plan {
+		sm.logger.Info("Starting phase", map[string]interface{}{
+			"phase":    phase.phase.Name,
+			"services": phase.services(),
 		})
-		return err
+
+		for _, wave := range phase.waves {
+			startedWave, errs := sm.startWave(ctx, services, wave)
+			started = append(started, startedWave)
+
+			if len(errs) > 0 {
+				sm.opMutex.Lock()
+				if sm.stopping == stopping {
+					close(stopping)
+					sm.stopping = nil
+				}
+				sm.opMutex.Unlock()
+
+				// Stop the already started services. The start context may already be done,
+				// so the rollback is only bounded by the stop timeouts and rollbackTimeout.
+				rollbackCtx, cancelRollback := context.WithCancel(context.Background())
+				if rollbackTimeout > 0 {
+					rollbackCtx, cancelRollback = context.WithTimeout(context.Background(), rollbackTimeout)
+				}
+				stopCtx, cancel := sm.withStopTimeout(rollbackCtx)
+				for i := len(started) - 1; i >= 0; i-- {
+					for _, stopErr := range sm.stopWave(stopCtx, services, started[i]) {
+						stopErr.Op = OpRollback
+						errs = append(errs, stopErr)
+					}
+				}
+				cancel()
+				cancelRollback()
+
+				err := errorOrNil(errs)
+				sm.logger.Error("Error during starting services", errorFields(err), durationField(began))
+				return err
+			}
+		}
 	}
 
-	sm.logger.Info("All services started successfully")
+	sm.active = true
+	sm.setReady(true)
+	go sm.probeHealth(stopping)
+
+	sm.logger.Info("All services started successfully", durationField(began))
 	return nil
 }
 
-// Stop stops all services concurrently.
-// If any service fails to stop, it continues to stop other services and returns the error.
+// Stop stops all services in reverse dependency order.
+// It is equivalent to StopContext with a background context.
 func (sm *ServiceManager) Stop() error {
+	return sm.StopContext(context.Background())
+}
+
+// StopContext stops all started services in reverse dependency order.
+// Services implementing Drainer are first drained concurrently, bounded by the drain timeout,
+// while the manager reports not ready.
+// Services are stopped in waves; a service is only stopped once every service depending
+// on it has stopped. If any service fails to stop or does not stop before the context is
+// done, it continues to stop other services and returns the error.
+func (sm *ServiceManager) StopContext(ctx context.Context) error {
 	sm.logger.Info("Stopping services...")
+	began := time.Now()
+	sm.setReady(false)
+	sm.control.Lock()
+	defer sm.control.Unlock()
+
 	sm.opMutex.Lock()
 	sm.operating = true
+	if sm.stopping != nil {
+		close(sm.stopping)
+		sm.stopping = nil
+	}
 	sm.opMutex.Unlock()
 
 	defer func() {
@@ -153,35 +409,311 @@ func (sm *ServiceManager) Stop() error {
 		sm.opMutex.Unlock()
 	}()
 
+	sm.active = false
+
+	services := sm.entries()
+	for _, entry := range services {
+		// Services exiting from now on are stopping, not failing.
+		entry.halt()
+	}
+
+	plan, err := startPlan(services)
+	if err != nil {
+		// Without a valid order the best we can do is stop everything at once.
+		sm.logger.Warn("Error resolving service dependencies, stopping all services concurrently", map[string]interface{}{
+			"error": err.Error(),
+		})
+
+		var names []ServiceName
+		for name := range services {
+			names = append(names, name)
+		}
+		sortServiceNames(names)
+		plan = []phasePlan{{phase: PhaseCore, waves: [][]ServiceName{names}}}
+	}
+
+	ctx, cancel := sm.withStopTimeout(ctx)
+	defer cancel()
+
+	// Readiness is already withdrawn, so services can finish their work in flight.
+	sm.setDraining(true)
+	sm.drain(ctx, services)
+	sm.setDraining(false)
+
+	var errs []*ServiceError
+	for i := len(plan) - 1; i >= 0; i-- {
+		sm.logger.Info("Stopping phase", map[string]interface{}{
+			"phase": plan[i].phase.Name,
+		})
+
+		for j := len(plan[i].waves) - 1; j >= 0; j-- {
+			errs = append(errs, sm.stopWave(ctx, services, plan[i].waves[j])...)
+		}
+	}
+
+	if err := errorOrNil(errs); err != nil {
+		sm.logger.Error("Error during stopping services", errorFields(err), durationField(began))
+		return err
+	}
+
+	sm.logger.Info("All services stopped successfully", durationField(began))
+	return nil
+}
+
+// withStopTimeout bounds the context by the stop timeout of the manager.
+func (sm *ServiceManager) withStopTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if sm.stopTimeout > 0 {
+		return context.WithTimeout(ctx, sm.stopTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// entries returns a copy of the services added to the manager.
+func (sm *ServiceManager) entries() map[ServiceName]*serviceEntry {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	var g errgroup.Group
-	for name, s := range sm.services {
+	services := make(map[ServiceName]*serviceEntry, len(sm.services))
+	for name, entry := range sm.services {
+		services[name] = entry
+	}
+
+	return services
+}
+
+// startWave starts the services concurrently and returns the ones that started successfully,
+// together with the errors of the ones that did not. Once a service fails to start, the
+// starts of the other services are cancelled. Services which are already running are skipped.
+func (sm *ServiceManager) startWave(ctx context.Context, services map[ServiceName]*serviceEntry, wave []ServiceName) ([]ServiceName, []*ServiceError) {
+	var started []ServiceName
+	var errs []*ServiceError
+	var mu sync.Mutex
+
+	waveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, name := range wave {
 		// Copy variables to prevent data race
-		s := s
 		name := name
+		entry := services[name]
+
+		if entry.isStarted() && entry.snapshot().State == StateRunning {
+			continue
+		}
+
+		sm.spawn(&wg, func() {
+			// Do not begin starting a service once the start deadline has passed or
+			// another service failed.
+			if err := ctx.Err(); err != nil {
+				if errors.Is(err, context.DeadlineExceeded) {
+					err = &TimeoutError{Service: name, Operation: OpStart, Timeout: sm.startTimeout}
+				}
+
+				mu.Lock()
+				errs = append(errs, asServiceError(name, OpStart, sm.startFailed(entry, err)))
+				mu.Unlock()
+				return
+			}
+			if waveCtx.Err() != nil {
+				return
+			}
+
+			late, err := sm.startService(waveCtx, entry)
+
+			mu.Lock()
+			defer mu.Unlock()
 
-		g.Go(func() error {
-			if err := s.Stop(); err != nil {
-				sm.logger.Error(fmt.Sprintf("Error stopping service %s", name), map[string]interface{}{
-					"error": err.Error(),
-				})
-				return fmt.Errorf("error stopping service %s: %w", name, err)
+			if err == nil {
+				started = append(started, name)
+				return
 			}
 
-			sm.logger.Info(fmt.Sprintf("Service %s stopped successfully", name))
-			return nil
+			cancel()
+			if late != nil {
+				go sm.settleStart(entry, late)
+			}
+
+			// A start cancelled because another service failed is not a failure of its own.
+			if !errors.Is(err, context.Canceled) || ctx.Err() != nil {
+				errs = append(errs, asServiceError(name, OpStart, err))
+			}
 		})
 	}
 
-	if err := g.Wait(); err != nil {
-		sm.logger.Error("Error during stopping services", map[string]interface{}{
-			"error": err.Error(),
+	wg.Wait()
+	sortServiceErrors(errs)
+	return started, errs
+}
+
+// stopWave stops the services concurrently and returns the errors of the ones that failed to stop.
+func (sm *ServiceManager) stopWave(ctx context.Context, services map[ServiceName]*serviceEntry, wave []ServiceName) []*ServiceError {
+	var errs []*ServiceError
+	var mu sync.Mutex
+
+	var wg sync.WaitGroup
+	for _, name := range wave {
+		// Copy variables to prevent data race
+		name := name
+		entry := services[name]
+
+		sm.spawn(&wg, func() {
+			if err := sm.stopService(ctx, entry); err != nil {
+				mu.Lock()
+				errs = append(errs, asServiceError(name, OpStop, err))
+				mu.Unlock()
+			}
 		})
-		return err
 	}
 
-	sm.logger.Info("All services stopped successfully")
+	wg.Wait()
+	sortServiceErrors(errs)
+	return errs
+}
+
+// spawn runs fn in a new goroutine tracked by the wait group, or right away if the
+// manager handles services sequentially.
+func (sm *ServiceManager) spawn(wg *sync.WaitGroup, fn func()) {
+	wg.Add(1)
+	if sm.sequential {
+		defer wg.Done()
+		fn()
+		return
+	}
+
+	go func() {
+		defer wg.Done()
+		fn()
+	}()
+}
+
+// startService starts a single service. Services reporting asynchronous failure are
+// supervised until the service is stopped by the manager.
+// If the start is given up on because the context is done, it also returns a channel
+// receiving the result of the start once it returns, which is passed to settleStart.
+func (sm *ServiceManager) startService(ctx context.Context, entry *serviceEntry) (<-chan error, error) {
+	entry.lifecycle.Lock()
+	began := time.Now()
+	sm.transition(entry, StateStarting, nil)
+	stopping := entry.run()
+	opCtx, end := sm.instrumentation.StartOperation(ctx, entry.name, OpStart)
+	late, err := callAbandonableWithTimeout(opCtx, entry.name, OpStart, entry.startTimeout, startFunc(entry.service))
+	end(err)
+	if err != nil {
+		entry.release()
+	}
+	entry.lifecycle.Unlock()
+
+	if err != nil {
+		return late, sm.startFailed(entry, err)
+	}
+
+	sm.transition(entry, StateRunning, nil)
+	if _, ok := underlying(entry.service).(Waitable); ok {
+		go sm.supervise(entry, stopping)
+	}
+
+	sm.logger.Info("Service started successfully", entry.logFields(durationField(began)))
+	return nil, nil
+}
+
+// settleStart waits for a start which was given up on and stops the service if it started
+// after all, unless the service was started again in the meantime.
+func (sm *ServiceManager) settleStart(entry *serviceEntry, late <-chan error) {
+	if err := <-late; err != nil || entry.isStarted() {
+		return
+	}
+
+	sm.logger.Warn("Service started after it was given up on, stopping it", entry.logFields())
+	entry.run()
+
+	ctx, cancel := sm.withStopTimeout(context.Background())
+	defer cancel()
+	sm.stopService(ctx, entry)
+}
+
+// startFailed records that a service failed to start and returns the error to report.
+func (sm *ServiceManager) startFailed(entry *serviceEntry, err error) error {
+	sm.transition(entry, StateFailed, err)
+	sm.logger.Error("Error starting service", entry.logFields(errorFields(err)))
+	return &ServiceError{Service: entry.name, Op: OpStart, Err: err}
+}
+
+// stopService stops a single service if it was started by the manager.
+func (sm *ServiceManager) stopService(ctx context.Context, entry *serviceEntry) error {
+	if !entry.release() {
+		return nil
+	}
+
+	entry.lifecycle.Lock()
+	began := time.Now()
+	sm.transition(entry, StateStopping, nil)
+	opCtx, end := sm.instrumentation.StartOperation(ctx, entry.name, OpStop)
+	err := callWithTimeout(opCtx, entry.name, OpStop, entry.stopTimeout, entry.service.Stop)
+	end(err)
+	entry.lifecycle.Unlock()
+
+	if err != nil {
+		sm.transition(entry, StateFailed, err)
+		sm.logger.Error("Error stopping service", entry.logFields(errorFields(err), durationField(began)))
+		return &ServiceError{Service: entry.name, Op: OpStop, Err: err}
+	}
+
+	sm.transition(entry, StateStopped, nil)
+	sm.logger.Info("Service stopped successfully", entry.logFields(durationField(began)))
 	return nil
 }
+
+// run marks the service as started and returns the channel which is closed when the
+// manager stops supervising it.
+func (e *serviceEntry) run() <-chan struct{} {
+	e.supervision.Lock()
+	defer e.supervision.Unlock()
+
+	e.started = true
+	e.stopping = make(chan struct{})
+	return e.stopping
+}
+
+// halt ends the supervision of the service, so it is no longer restarted when it exits.
+func (e *serviceEntry) halt() {
+	e.supervision.Lock()
+	defer e.supervision.Unlock()
+
+	if e.stopping != nil {
+		close(e.stopping)
+		e.stopping = nil
+	}
+}
+
+// release ends the supervision of the service and marks it as no longer started.
+// It reports whether the service was started.
+func (e *serviceEntry) release() bool {
+	e.supervision.Lock()
+	defer e.supervision.Unlock()
+
+	if e.stopping != nil {
+		close(e.stopping)
+		e.stopping = nil
+	}
+
+	started := e.started
+	e.started = false
+	return started
+}
+
+// close releases what the manager holds for the service once it is removed.
+func (e *serviceEntry) close() {
+	if e.unsubscribe != nil {
+		e.unsubscribe()
+	}
+}
+
+// isStarted reports whether the service was started and not stopped by the manager since.
+func (e *serviceEntry) isStarted() bool {
+	e.supervision.Lock()
+	defer e.supervision.Unlock()
+
+	return e.started
+}
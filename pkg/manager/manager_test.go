@@ -1,27 +1,43 @@
 package manager_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/flowshot-io/x/pkg/config"
 	"github.com/flowshot-io/x/pkg/logger"
 	"github.com/flowshot-io/x/pkg/manager"
+	"github.com/flowshot-io/x/pkg/manager/managertest"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type SimpleService struct {
 	name    manager.ServiceName
-	started bool
-	stopped bool
+	started atomic.Bool
+	stopped atomic.Bool
 }
 
 func (s *SimpleService) Start() error {
-	s.started = true
+	s.started.Store(true)
 	return nil
 }
 
 func (s *SimpleService) Stop() error {
-	s.stopped = true
+	s.stopped.Store(true)
 	return nil
 }
 
@@ -44,11 +60,11 @@ func TestServiceManager(t *testing.T) {
 			t.Fatalf("Failed to start services: %v", err)
 		}
 
-		if !s1.started {
+		if !s1.started.Load() {
 			t.Errorf("Service1 was not started")
 		}
 
-		if !s2.started {
+		if !s2.started.Load() {
 			t.Errorf("Service2 was not started")
 		}
 	})
@@ -75,11 +91,11 @@ func TestServiceManager(t *testing.T) {
 			t.Fatalf("Failed to stop services: %v", err)
 		}
 
-		if !s1.stopped {
+		if !s1.stopped.Load() {
 			t.Errorf("Service1 was not stopped")
 		}
 
-		if !s2.stopped {
+		if !s2.stopped.Load() {
 			t.Errorf("Service2 was not stopped")
 		}
 	})
@@ -113,3 +129,1278 @@ func TestRaceCondition(t *testing.T) {
 		t.Fatalf("Failed to stop services: %v", err)
 	}
 }
+
+type OrderedService struct {
+	name     manager.ServiceName
+	mu       *sync.Mutex
+	events   *[]string
+	startErr error
+	stopErr  error
+}
+
+func (s *OrderedService) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.events = append(*s.events, "start "+string(s.name))
+	return s.startErr
+}
+
+func (s *OrderedService) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.events = append(*s.events, "stop "+string(s.name))
+	return s.stopErr
+}
+
+func TestDependencyOrder(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	newService := func(name manager.ServiceName) *OrderedService {
+		return &OrderedService{name: name, mu: &mu, events: &events}
+	}
+
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+	if err := serviceManager.Add("http", newService("http"), manager.DependsOn("cache", "database")); err != nil {
+		t.Fatalf("Failed to add service: %v", err)
+	}
+	if err := serviceManager.Add("cache", newService("cache"), manager.DependsOn("database")); err != nil {
+		t.Fatalf("Failed to add service: %v", err)
+	}
+	if err := serviceManager.Add("database", newService("database")); err != nil {
+		t.Fatalf("Failed to add service: %v", err)
+	}
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+
+	if err := serviceManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+
+	expected := []string{"start database", "start cache", "start http", "stop http", "stop cache", "stop database"}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("Expected lifecycle order %v, got %v", expected, events)
+	}
+}
+
+func TestDependencyRollback(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+	serviceManager.Add("database", &OrderedService{name: "database", mu: &mu, events: &events})
+	serviceManager.Add("http", &OrderedService{name: "http", mu: &mu, events: &events, startErr: errors.New("boom")}, manager.DependsOn("database"))
+
+	if err := serviceManager.Start(); err == nil {
+		t.Fatalf("Expected start to fail")
+	}
+
+	expected := []string{"start database", "start http", "stop database"}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("Expected lifecycle order %v, got %v", expected, events)
+	}
+}
+
+func TestErrorAggregation(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	errStart := errors.New("start failed")
+	errStop := errors.New("stop failed")
+
+	t.Run("Start And Rollback", func(t *testing.T) {
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("database", &OrderedService{name: "database", mu: &mu, events: &events, stopErr: errStop})
+		serviceManager.Add("queue", &OrderedService{name: "queue", mu: &mu, events: &events, stopErr: errStop})
+		serviceManager.Add("http", &OrderedService{name: "http", mu: &mu, events: &events, startErr: errStart}, manager.DependsOn("database", "queue"))
+
+		err := serviceManager.Start()
+
+		var multiErr *manager.MultiError
+		if !errors.As(err, &multiErr) {
+			t.Fatalf("Expected a MultiError, got %v", err)
+		}
+
+		expected := []manager.ServiceName{"http", "database", "queue"}
+		if fmt.Sprint(multiErr.Services()) != fmt.Sprint(expected) {
+			t.Errorf("Expected failed services %v, got %v", expected, multiErr.Services())
+		}
+
+		var serviceErr *manager.ServiceError
+		if !errors.As(err, &serviceErr) || serviceErr.Service != "http" || serviceErr.Op != manager.OpStart {
+			t.Errorf("Expected the first ServiceError to be the start of http, got %v", serviceErr)
+		}
+
+		if multiErr.Errors[1].Op != manager.OpRollback || multiErr.Errors[2].Op != manager.OpRollback {
+			t.Errorf("Expected the failed stops to be reported as rollback, got %v", err)
+		}
+
+		if !errors.Is(err, errStart) || !errors.Is(err, errStop) {
+			t.Errorf("Expected error to match the start and stop errors, got %v", err)
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("a", &OrderedService{name: "a", mu: &mu, events: &events, stopErr: errStop})
+		serviceManager.Add("b", &OrderedService{name: "b", mu: &mu, events: &events})
+		serviceManager.Add("c", &OrderedService{name: "c", mu: &mu, events: &events, stopErr: errStop}, manager.DependsOn("b"))
+
+		if err := serviceManager.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+
+		err := serviceManager.Stop()
+
+		var multiErr *manager.MultiError
+		if !errors.As(err, &multiErr) || fmt.Sprint(multiErr.Services()) != "[c a]" {
+			t.Fatalf("Expected stop errors for c and a, got %v", err)
+		}
+
+		if !errors.Is(err, errStop) {
+			t.Errorf("Expected error to match the stop error")
+		}
+	})
+}
+
+type CancellableService struct {
+	starting  chan struct{}
+	cancelled chan struct{}
+}
+
+func (s *CancellableService) Start(ctx context.Context) error {
+	close(s.starting)
+	<-ctx.Done()
+	close(s.cancelled)
+	return ctx.Err()
+}
+
+func (s *CancellableService) Stop(ctx context.Context) error {
+	return nil
+}
+
+type FuncService struct {
+	start func() error
+}
+
+func (s *FuncService) Start() error {
+	return s.start()
+}
+
+func (s *FuncService) Stop() error {
+	return nil
+}
+
+type StubbornService struct {
+	starting chan struct{}
+	release  chan struct{}
+	stopped  atomic.Bool
+}
+
+func (s *StubbornService) Start() error {
+	close(s.starting)
+	<-s.release
+	return nil
+}
+
+func (s *StubbornService) Stop() error {
+	s.stopped.Store(true)
+	return nil
+}
+
+func TestStartCancellation(t *testing.T) {
+	errStart := errors.New("start failed")
+	cancellable := &CancellableService{starting: make(chan struct{}), cancelled: make(chan struct{})}
+	stubborn := &StubbornService{starting: make(chan struct{}), release: make(chan struct{})}
+
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+	serviceManager.AddContext("cancellable", cancellable)
+	serviceManager.Add("stubborn", stubborn)
+	serviceManager.Add("broken", &FuncService{start: func() error {
+		<-cancellable.starting
+		<-stubborn.starting
+		return errStart
+	}})
+
+	err := serviceManager.Start()
+
+	var multiErr *manager.MultiError
+	if !errors.As(err, &multiErr) || fmt.Sprint(multiErr.Services()) != "[broken]" {
+		t.Fatalf("Expected only broken to be reported, got %v", err)
+	}
+
+	select {
+	case <-cancellable.cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Expected the start of cancellable to be cancelled")
+	}
+
+	// The stubborn service ignores the cancellation and starts after the rollback.
+	close(stubborn.release)
+	waitFor(t, stubborn.stopped.Load)
+	waitFor(t, func() bool {
+		for _, status := range serviceManager.Status() {
+			if status.Name == "stubborn" {
+				return status.State == manager.StateStopped
+			}
+		}
+		return false
+	})
+}
+
+func TestPhases(t *testing.T) {
+	t.Run("Ordering", func(t *testing.T) {
+		var mu sync.Mutex
+		var events []string
+		newService := func(name manager.ServiceName) *OrderedService {
+			return &OrderedService{name: name, mu: &mu, events: &events}
+		}
+
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp(), Sequential: true})
+		serviceManager.Add("worker", newService("worker"), manager.InPhase(manager.PhaseIngress), manager.DependsOn("api"))
+		serviceManager.Add("http", newService("http"), manager.InPhase(manager.PhaseIngress))
+		serviceManager.Add("api", newService("api"), manager.DependsOn("database"))
+		serviceManager.Add("database", newService("database"), manager.InPhase(manager.PhaseInfra))
+		serviceManager.Add("cache", newService("cache"), manager.InPhase(manager.PhaseInfra))
+
+		if err := serviceManager.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+
+		if err := serviceManager.Stop(); err != nil {
+			t.Fatalf("Failed to stop services: %v", err)
+		}
+
+		expected := []string{
+			"start cache", "start database", "start api", "start http", "start worker",
+			"stop http", "stop worker", "stop api", "stop cache", "stop database",
+		}
+		if fmt.Sprint(events) != fmt.Sprint(expected) {
+			t.Errorf("Expected lifecycle order %v, got %v", expected, events)
+		}
+
+		if status := serviceManager.Status(); status[0].Name != "api" || status[0].Phase != "core" {
+			t.Errorf("Expected api in phase core, got %+v", status[0])
+		}
+	})
+
+	t.Run("Dependency In Later Phase", func(t *testing.T) {
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("api", &SimpleService{name: "api"})
+		serviceManager.Add("database", &SimpleService{name: "database"}, manager.InPhase(manager.PhaseInfra), manager.DependsOn("api"))
+
+		if err := serviceManager.Start(); !errors.Is(err, manager.ErrPhaseOrder) {
+			t.Errorf("Expected ErrPhaseOrder, got %v", err)
+		}
+	})
+}
+
+func TestDependencyValidation(t *testing.T) {
+	t.Run("Missing Dependency", func(t *testing.T) {
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("http", &SimpleService{name: "http"}, manager.DependsOn("database"))
+
+		if err := serviceManager.Start(); !errors.Is(err, manager.ErrMissingDependency) {
+			t.Errorf("Expected ErrMissingDependency, got %v", err)
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("a", &SimpleService{name: "a"}, manager.DependsOn("b"))
+		serviceManager.Add("b", &SimpleService{name: "b"}, manager.DependsOn("a"))
+
+		if err := serviceManager.Start(); !errors.Is(err, manager.ErrDependencyCycle) {
+			t.Errorf("Expected ErrDependencyCycle, got %v", err)
+		}
+	})
+}
+
+type HangingService struct {
+	release  chan struct{}
+	stopOnly bool
+}
+
+func (s *HangingService) Start(ctx context.Context) error {
+	if !s.stopOnly {
+		<-s.release
+	}
+	return nil
+}
+
+func (s *HangingService) Stop(ctx context.Context) error {
+	<-s.release
+	return nil
+}
+
+func TestTimeouts(t *testing.T) {
+	t.Run("Service Start Timeout", func(t *testing.T) {
+		hanging := &HangingService{release: make(chan struct{})}
+		defer close(hanging.release)
+
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.AddContext("hanging", hanging, manager.WithStartTimeout(10*time.Millisecond))
+
+		var timeoutErr *manager.TimeoutError
+		err := serviceManager.Start()
+		if !errors.As(err, &timeoutErr) || timeoutErr.Service != "hanging" || timeoutErr.Operation != "start" {
+			t.Fatalf("Expected a start TimeoutError for service hanging, got %v", err)
+		}
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected error to match context.DeadlineExceeded")
+		}
+	})
+
+	t.Run("Global Stop Timeout", func(t *testing.T) {
+		hanging := &HangingService{release: make(chan struct{}), stopOnly: true}
+		defer close(hanging.release)
+
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp(), StopTimeout: 10 * time.Millisecond})
+		serviceManager.Add("simple", &SimpleService{name: "simple"})
+		serviceManager.AddContext("hanging", hanging, manager.DependsOn("simple"))
+
+		if err := serviceManager.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+
+		var timeoutErr *manager.TimeoutError
+		if err := serviceManager.Stop(); !errors.As(err, &timeoutErr) || timeoutErr.Service != "hanging" {
+			t.Fatalf("Expected a stop TimeoutError for service hanging, got %v", err)
+		}
+	})
+
+	t.Run("Adapters", func(t *testing.T) {
+		s := &SimpleService{name: "simple"}
+		if manager.ToService(manager.FromService(s)) != manager.Service(s) {
+			t.Errorf("Expected adapters to unwrap each other")
+		}
+	})
+}
+
+type BackgroundService struct {
+	SimpleService
+	done chan error
+}
+
+func (s *BackgroundService) Done() <-chan error {
+	return s.done
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Context Cancelled", func(t *testing.T) {
+		s := &SimpleService{name: "simple"}
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("simple", s)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if err := serviceManager.Run(ctx); err != nil {
+			t.Fatalf("Expected graceful shutdown, got %v", err)
+		}
+
+		if !s.started.Load() || !s.stopped.Load() {
+			t.Errorf("Expected service to be started and stopped")
+		}
+	})
+
+	t.Run("Service Failure", func(t *testing.T) {
+		failure := errors.New("connection lost")
+		s := &BackgroundService{done: make(chan error, 1)}
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("background", s)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			s.done <- failure
+		}()
+
+		if err := serviceManager.Run(context.Background()); !errors.Is(err, failure) {
+			t.Fatalf("Expected Run to return the service failure, got %v", err)
+		}
+
+		if !s.stopped.Load() {
+			t.Errorf("Expected service to be stopped")
+		}
+	})
+
+	// newSignalRun runs a manager with a database whose Stop hangs and a queue depending on
+	// it, whose Start hangs if hangOnStart is set. Run shuts down on SIGHUP.
+	newSignalRun := func(t *testing.T, hangOnStart bool, opts manager.Options) (*managertest.Service, *managertest.Service, <-chan error, func()) {
+		t.Helper()
+		if runtime.GOOS == "windows" {
+			t.Skip("Sending signals is not supported on windows")
+		}
+
+		database := managertest.NewService("database", managertest.HangOnStop())
+		queueOpts := []managertest.Option{}
+		if hangOnStart {
+			queueOpts = append(queueOpts, managertest.HangOnStart())
+		}
+		queue := managertest.NewService("queue", queueOpts...)
+		t.Cleanup(database.Release)
+
+		opts.Logger = logger.NoOp()
+		opts.Signals = []os.Signal{syscall.SIGHUP}
+		serviceManager := manager.New(&opts)
+		serviceManager.AddContext("database", database)
+		serviceManager.AddContext("queue", queue, manager.DependsOn("database"))
+
+		result := make(chan error, 1)
+		go func() {
+			result <- serviceManager.Run(context.Background())
+		}()
+
+		signal := func() {
+			t.Helper()
+
+			process, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				t.Fatalf("Failed to find process: %v", err)
+			}
+
+			if err := process.Signal(syscall.SIGHUP); err != nil {
+				t.Fatalf("Failed to send signal: %v", err)
+			}
+		}
+
+		return database, queue, result, signal
+	}
+
+	waitResult := func(t *testing.T, result <-chan error) error {
+		t.Helper()
+
+		select {
+		case err := <-result:
+			return err
+		case <-time.After(time.Second):
+			t.Fatalf("Expected Run to return")
+			return nil
+		}
+	}
+
+	t.Run("Shutdown Deadline", func(t *testing.T) {
+		database, queue, result, signal := newSignalRun(t, false, manager.Options{ShutdownTimeout: 50 * time.Millisecond})
+		waitFor(t, queue.Running)
+
+		signal()
+		if err := waitResult(t, result); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the shutdown to be cut short, got %v", err)
+		}
+
+		if database.Stops() != 1 {
+			t.Errorf("Expected the database to be stopped")
+		}
+	})
+
+	t.Run("Signal During Start", func(t *testing.T) {
+		database, queue, result, signal := newSignalRun(t, true, manager.Options{ShutdownTimeout: 50 * time.Millisecond})
+		waitFor(t, func() bool { return queue.Starts() == 1 })
+
+		// The start is cancelled and the rollback is bounded by the shutdown timeout.
+		signal()
+		if err := waitResult(t, result); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the start to be cancelled, got %v", err)
+		}
+
+		if database.Stops() != 1 {
+			t.Errorf("Expected the database to be stopped")
+		}
+	})
+
+	t.Run("Forced Exit", func(t *testing.T) {
+		for _, hangOnStart := range []bool{false, true} {
+			exits := make(chan int, 1)
+			database, queue, result, signal := newSignalRun(t, hangOnStart, manager.Options{
+				ExitFunc: func(code int) { exits <- code },
+			})
+			waitFor(t, func() bool { return queue.Starts() == 1 })
+
+			signal()
+			waitFor(t, func() bool { return database.Stops() == 1 })
+
+			signal()
+			if err := waitResult(t, result); !errors.Is(err, manager.ErrForcedShutdown) {
+				t.Errorf("Expected a forced shutdown, got %v", err)
+			}
+
+			if code := <-exits; code != 1 {
+				t.Errorf("Expected exit code 1, got %d", code)
+			}
+		}
+	})
+}
+
+type CheckedService struct {
+	SimpleService
+	mu  sync.Mutex
+	err error
+}
+
+func (s *CheckedService) HealthCheck(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *CheckedService) setHealth(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func TestHealth(t *testing.T) {
+	s := &CheckedService{}
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp(), HealthCheckInterval: 5 * time.Millisecond})
+	serviceManager.Add("checked", s)
+
+	handler := serviceManager.HealthHandler()
+	probe := func(path string) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder.Code
+	}
+
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready before start, got %d", code)
+	}
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+
+	if code := probe("/readyz"); code != http.StatusOK {
+		t.Errorf("Expected ready after start, got %d", code)
+	}
+
+	s.setHealth(errors.New("database unreachable"))
+	time.Sleep(50 * time.Millisecond)
+
+	if code := probe("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected unhealthy service to fail liveness, got %d", code)
+	}
+
+	report := serviceManager.Health()
+	if report.Ready || report.Services["checked"].Error != "database unreachable" {
+		t.Errorf("Unexpected health report: %+v", report)
+	}
+
+	if err := serviceManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready after stop, got %d", code)
+	}
+
+	// Starting again retires the health prober of the previous start.
+	clock := managertest.NewFakeClock(time.Now())
+	serviceManager = manager.New(&manager.Options{Logger: logger.NoOp(), Clock: clock})
+	serviceManager.Add("checked", &CheckedService{})
+
+	for i := 0; i < 2; i++ {
+		if err := serviceManager.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+	}
+	waitFor(t, func() bool { return clock.Waiters() == 1 })
+
+	if err := serviceManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+	waitFor(t, func() bool { return clock.Waiters() == 0 })
+}
+
+type RestartableService struct {
+	mu     sync.Mutex
+	starts int
+	stops  int
+	done   chan error
+}
+
+func (s *RestartableService) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.starts++
+	s.done = make(chan error, 1)
+	return nil
+}
+
+func (s *RestartableService) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stops++
+	return nil
+}
+
+func (s *RestartableService) Done() <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+func (s *RestartableService) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done <- err
+}
+
+func (s *RestartableService) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.starts, s.stops
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	s := &RestartableService{}
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+	serviceManager.Add("worker", s, manager.WithRestartPolicy(manager.RestartPolicy{
+		Mode:        manager.RestartOnFailure,
+		MaxRestarts: 1,
+		Backoff:     time.Millisecond,
+	}))
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+
+	s.fail(errors.New("crashed"))
+	waitFor(t, func() bool { starts, _ := s.counts(); return starts == 2 })
+
+	// The second failure exhausts the restarts and escalates to stopping the manager.
+	s.fail(errors.New("crashed again"))
+	waitFor(t, func() bool { _, stops := s.counts(); return stops == 2 })
+
+	if starts, _ := s.counts(); starts != 2 {
+		t.Errorf("Expected service to be started twice, got %d", starts)
+	}
+}
+
+func TestStatusAndEvents(t *testing.T) {
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+	serviceManager.Add("ok", &SimpleService{name: "ok"})
+
+	events, cancel := serviceManager.Subscribe(0)
+	defer cancel()
+
+	if status := serviceManager.Status(); len(status) != 1 || status[0].State != manager.StateNew {
+		t.Fatalf("Expected a new service, got %+v", status)
+	}
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+
+	if status := serviceManager.Status(); status[0].State != manager.StateRunning || status[0].StartedAt.IsZero() {
+		t.Errorf("Expected a running service, got %+v", status)
+	}
+
+	if err := serviceManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+
+	var transitions []string
+	for i := 0; i < 4; i++ {
+		event := <-events
+		transitions = append(transitions, fmt.Sprintf("%s->%s", event.From, event.To))
+	}
+
+	expected := []string{"new->starting", "starting->running", "running->stopping", "stopping->stopped"}
+	if fmt.Sprint(transitions) != fmt.Sprint(expected) {
+		t.Errorf("Expected transitions %v, got %v", expected, transitions)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("Expected the event channel to be closed after cancelling")
+	}
+}
+
+func TestRuntimeControl(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	newService := func(name manager.ServiceName) *OrderedService {
+		return &OrderedService{name: name, mu: &mu, events: &events}
+	}
+	takeEvents := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		taken := fmt.Sprint(events)
+		events = nil
+		return taken
+	}
+
+	ctx := context.Background()
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+	serviceManager.Add("database", newService("database"))
+	serviceManager.Add("worker", newService("worker"), manager.DependsOn("database"))
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+	takeEvents()
+
+	if err := serviceManager.Add("plugin", newService("plugin"), manager.DependsOn("database")); err != nil {
+		t.Fatalf("Failed to hot-add service: %v", err)
+	}
+	if got := takeEvents(); got != "[start plugin]" {
+		t.Errorf("Expected hot-added service to start, got %v", got)
+	}
+
+	if err := serviceManager.Add("plugin", newService("plugin")); !errors.Is(err, manager.ErrServiceStarted) {
+		t.Errorf("Expected ErrServiceStarted, got %v", err)
+	}
+
+	if err := serviceManager.StopService(ctx, "database"); !errors.Is(err, manager.ErrServiceRequired) {
+		t.Errorf("Expected ErrServiceRequired, got %v", err)
+	}
+
+	if err := serviceManager.RestartService(ctx, "database"); err != nil {
+		t.Fatalf("Failed to restart service: %v", err)
+	}
+	if got := takeEvents(); got != "[stop database start database]" {
+		t.Errorf("Expected only database to restart, got %v", got)
+	}
+
+	if err := serviceManager.StopService(ctx, "plugin"); err != nil {
+		t.Fatalf("Failed to stop service: %v", err)
+	}
+	if err := serviceManager.StartService(ctx, "plugin"); err != nil {
+		t.Fatalf("Failed to start service: %v", err)
+	}
+	if err := serviceManager.StartService(ctx, "plugin"); err != nil {
+		t.Fatalf("Failed to start running service: %v", err)
+	}
+	if got := takeEvents(); got != "[stop plugin start plugin]" {
+		t.Errorf("Expected plugin to stop and start once, got %v", got)
+	}
+
+	if err := serviceManager.Remove(ctx, "database"); !errors.Is(err, manager.ErrServiceRequired) {
+		t.Errorf("Expected ErrServiceRequired, got %v", err)
+	}
+	if err := serviceManager.Remove(ctx, "plugin"); err != nil {
+		t.Fatalf("Failed to remove service: %v", err)
+	}
+	if err := serviceManager.StartService(ctx, "plugin"); !errors.Is(err, manager.ErrUnknownService) {
+		t.Errorf("Expected ErrUnknownService, got %v", err)
+	}
+
+	if err := serviceManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+	if got := takeEvents(); got != "[stop plugin stop worker stop database]" {
+		t.Errorf("Expected removed service to stop once, got %v", got)
+	}
+
+	if err := serviceManager.Add("plugin", newService("plugin")); err != nil {
+		t.Fatalf("Failed to add service: %v", err)
+	}
+	if got := takeEvents(); got != "[]" {
+		t.Errorf("Expected no service to start on a stopped manager, got %v", got)
+	}
+}
+
+// recordingInstrumentation is an Instrumentation implementation that keeps what it observed.
+type recordingInstrumentation struct {
+	mu          sync.Mutex
+	operations  []string
+	transitions []string
+	restarts    int
+}
+
+func (r *recordingInstrumentation) StartOperation(ctx context.Context, service manager.ServiceName, op string) (context.Context, func(err error)) {
+	return ctx, func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.operations = append(r.operations, op+" "+string(service))
+	}
+}
+
+func (r *recordingInstrumentation) ObserveTransition(service manager.ServiceName, from, to manager.State) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transitions = append(r.transitions, to.String())
+}
+
+func (r *recordingInstrumentation) ObserveRestart(service manager.ServiceName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.restarts++
+}
+
+func TestInstrumentation(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := manager.NewPrometheusInstrumentation(registry, "test")
+	if err != nil {
+		t.Fatalf("Failed to create instrumentation: %v", err)
+	}
+	recording := &recordingInstrumentation{}
+
+	s := &RestartableService{}
+	serviceManager := manager.New(&manager.Options{
+		Logger:          logger.NoOp(),
+		Instrumentation: manager.MultiInstrumentation(metrics, recording),
+	})
+	serviceManager.Add("worker", s, manager.WithRestartPolicy(manager.RestartPolicy{
+		Mode:    manager.RestartOnFailure,
+		Backoff: time.Millisecond,
+	}))
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+
+	s.fail(errors.New("crashed"))
+	waitFor(t, func() bool { starts, _ := s.counts(); return starts == 2 })
+	waitFor(t, func() bool {
+		for _, status := range serviceManager.Status() {
+			if status.State == manager.StateRunning {
+				return true
+			}
+		}
+		return false
+	})
+
+	if err := serviceManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+
+	recording.mu.Lock()
+	expected := "[start worker stop worker start worker stop worker]"
+	if fmt.Sprint(recording.operations) != expected {
+		t.Errorf("Expected operations %v, got %v", expected, recording.operations)
+	}
+	if recording.restarts != 1 {
+		t.Errorf("Expected 1 restart, got %d", recording.restarts)
+	}
+	recording.mu.Unlock()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "state" || label.GetName() == "operation" {
+					name += "/" + label.GetValue()
+				}
+			}
+
+			switch {
+			case metric.GetCounter() != nil:
+				values[name] = metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				values[name] = metric.GetGauge().GetValue()
+			case metric.GetHistogram() != nil:
+				values[name] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	for name, value := range map[string]float64{
+		"test_manager_service_restarts_total":           1,
+		"test_manager_service_failures_total":           1,
+		"test_manager_service_state/stopped":            1,
+		"test_manager_service_state/running":            0,
+		"test_manager_operation_duration_seconds/start": 2,
+		"test_manager_operation_duration_seconds/stop":  2,
+	} {
+		if values[name] != value {
+			t.Errorf("Expected %s to be %v, got %v", name, value, values[name])
+		}
+	}
+}
+
+type DrainingService struct {
+	*OrderedService
+	drain func(ctx context.Context) error
+}
+
+func (s *DrainingService) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	*s.events = append(*s.events, "drain "+string(s.name))
+	s.mu.Unlock()
+
+	return s.drain(ctx)
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("Before Stop", func(t *testing.T) {
+		var mu sync.Mutex
+		var events []string
+		var report manager.HealthReport
+
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("database", &OrderedService{name: "database", mu: &mu, events: &events})
+		serviceManager.Add("http", &DrainingService{
+			OrderedService: &OrderedService{name: "http", mu: &mu, events: &events},
+			drain: func(ctx context.Context) error {
+				report = serviceManager.Health()
+				return nil
+			},
+		}, manager.DependsOn("database"))
+
+		if err := serviceManager.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+
+		if err := serviceManager.Stop(); err != nil {
+			t.Fatalf("Failed to stop services: %v", err)
+		}
+
+		expected := []string{"start database", "start http", "drain http", "stop http", "stop database"}
+		if fmt.Sprint(events) != fmt.Sprint(expected) {
+			t.Errorf("Expected lifecycle order %v, got %v", expected, events)
+		}
+
+		if report.Ready || !report.Draining {
+			t.Errorf("Expected manager to be draining and not ready during drain, got %+v", report)
+		}
+
+		if serviceManager.Health().Draining {
+			t.Errorf("Expected draining to end once stopped")
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		var mu sync.Mutex
+		var events []string
+
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp(), DrainTimeout: 10 * time.Millisecond})
+		serviceManager.Add("consumer", &DrainingService{
+			OrderedService: &OrderedService{name: "consumer", mu: &mu, events: &events},
+			drain: func(ctx context.Context) error {
+				<-ctx.Done()
+				return errors.New("1 message in flight")
+			},
+		})
+
+		if err := serviceManager.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+
+		if err := serviceManager.StopService(context.Background(), "consumer"); err != nil {
+			t.Fatalf("Failed to stop service: %v", err)
+		}
+
+		expected := []string{"start consumer", "drain consumer", "stop consumer"}
+		if fmt.Sprint(events) != fmt.Sprint(expected) {
+			t.Errorf("Expected the service to be stopped after the drain deadline, got %v", events)
+		}
+	})
+}
+
+func TestNestedManagers(t *testing.T) {
+	t.Run("Status Health And Events", func(t *testing.T) {
+		checked := &CheckedService{}
+		child := manager.New(&manager.Options{Logger: logger.NoOp(), HealthCheckInterval: 5 * time.Millisecond})
+		child.Add("database", checked)
+
+		parent := manager.New(&manager.Options{Logger: logger.NoOp(), HealthCheckInterval: 5 * time.Millisecond})
+		parent.Add("storage", child)
+		parent.Add("api", &SimpleService{name: "api"}, manager.DependsOn("storage"))
+
+		events, cancel := parent.Subscribe(0)
+		defer cancel()
+
+		if err := parent.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+		defer parent.Stop()
+
+		status := parent.Status()
+		if status[1].Name != "storage" || len(status[1].Children) != 1 || status[1].Children[0].Name != "database" || status[1].Children[0].State != manager.StateRunning {
+			t.Errorf("Expected storage to report its running database, got %+v", status[1])
+		}
+
+		forwarded := false
+		for !forwarded {
+			select {
+			case event := <-events:
+				forwarded = event.Service == "storage/database" && event.To == manager.StateRunning
+			case <-time.After(time.Second):
+				t.Fatalf("Expected the events of the nested manager to be forwarded")
+			}
+		}
+
+		checked.setHealth(errors.New("connection lost"))
+		waitFor(t, func() bool { return !parent.Health().Services["storage"].Healthy })
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		s := &RestartableService{}
+		child := manager.New(&manager.Options{Logger: logger.NoOp()})
+		child.Add("worker", s)
+
+		api := &RestartableService{}
+		parent := manager.New(&manager.Options{Logger: logger.NoOp()})
+		parent.Add("subsystem", child)
+		parent.Add("api", api)
+
+		if err := parent.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+
+		// The failure escalates from the nested manager to the parent, which stops everything.
+		s.fail(errors.New("crashed"))
+		waitFor(t, func() bool { _, stops := api.counts(); return stops == 1 })
+		waitFor(t, func() bool { _, stops := s.counts(); return stops == 1 })
+	})
+}
+
+type PanickingService struct {
+	SimpleService
+}
+
+func (s *PanickingService) Stop() error {
+	var services map[string]string
+	services["panicking"] = "stopped"
+	return nil
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestPanicRecovery(t *testing.T) {
+	t.Run("Start", func(t *testing.T) {
+		recorder := managertest.NewRecorder()
+		logs := &lockedBuffer{}
+		serviceManager := manager.New(&manager.Options{Logger: logger.New(logger.WithWriters(logs))})
+		serviceManager.AddContext("database", managertest.NewService("database", managertest.WithRecorder(recorder)))
+		serviceManager.AddContext("queue", managertest.NewService("queue", managertest.WithRecorder(recorder), managertest.PanicOnStart("boom")), manager.DependsOn("database"))
+
+		err := serviceManager.Start()
+
+		var panicErr *manager.PanicError
+		if !errors.As(err, &panicErr) {
+			t.Fatalf("Expected a PanicError, got %v", err)
+		}
+		if panicErr.Service != "queue" || panicErr.Op != manager.OpStart || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+			t.Errorf("Expected the panic of queue with its stack, got %+v", panicErr)
+		}
+
+		recorder.AssertCalls(t, "database:start", "queue:start", "database:stop")
+		if !strings.Contains(logs.String(), "managertest") {
+			t.Errorf("Expected the stack trace to be logged, got %s", logs.String())
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+		serviceManager.Add("database", &SimpleService{name: "database"})
+		serviceManager.Add("panicking", &PanickingService{}, manager.DependsOn("database"))
+
+		if err := serviceManager.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+
+		err := serviceManager.Stop()
+
+		var panicErr *manager.PanicError
+		if !errors.As(err, &panicErr) || panicErr.Service != "panicking" || panicErr.Op != manager.OpStop {
+			t.Fatalf("Expected a stop PanicError for service panicking, got %v", err)
+		}
+
+		var runtimeErr runtime.Error
+		if !errors.As(err, &runtimeErr) {
+			t.Errorf("Expected the runtime error to be unwrapped, got %v", err)
+		}
+
+		if status := serviceManager.Status(); status[0].State != manager.StateStopped {
+			t.Errorf("Expected database to be stopped after the panic, got %s", status[0].State)
+		}
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	type serverSettings struct {
+		Addr string `json:"addr"`
+	}
+
+	var addr string
+	registry := manager.NewRegistry()
+	registry.Register("database", func(settings manager.Settings) (manager.ContextService, error) {
+		return managertest.NewService("database"), nil
+	}, manager.InPhase(manager.PhaseInfra))
+	registry.Register("http", func(settings manager.Settings) (manager.ContextService, error) {
+		var s serverSettings
+		if err := settings.Decode(&s); err != nil {
+			return nil, err
+		}
+		addr = s.Addr
+		return managertest.NewService("http"), nil
+	}, manager.DependsOn("database"))
+	registry.Register("worker", func(settings manager.Settings) (manager.ContextService, error) {
+		return managertest.NewService("worker"), nil
+	})
+
+	if err := registry.Register("worker", nil); !errors.Is(err, manager.ErrFactoryRegistered) {
+		t.Errorf("Expected ErrFactoryRegistered, got %v", err)
+	}
+
+	load := func(t *testing.T, content string) manager.Config {
+		t.Helper()
+
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "settings.yaml"), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		var settings struct {
+			Services manager.Config `json:"services"`
+		}
+		if err := config.Load(dir, "", &settings); err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+
+		return settings.Services
+	}
+
+	t.Run("Build", func(t *testing.T) {
+		cfg := load(t, `
+services:
+  enabled: [database, http]
+  settings:
+    http:
+      addr: ":8080"
+    worker:
+      queue: jobs
+`)
+
+		serviceManager, err := registry.Build(&manager.Options{Logger: logger.NoOp()}, cfg)
+		if err != nil {
+			t.Fatalf("Failed to build service manager: %v", err)
+		}
+
+		if addr != ":8080" {
+			t.Errorf("Expected the settings to be passed to the factory, got %q", addr)
+		}
+
+		status := serviceManager.Status()
+		if len(status) != 2 || status[0].Name != "database" || status[0].Phase != "infra" || status[1].Name != "http" {
+			t.Errorf("Expected database and http to be added, got %+v", status)
+		}
+
+		if err := serviceManager.Start(); err != nil {
+			t.Fatalf("Failed to start services: %v", err)
+		}
+		serviceManager.Stop()
+	})
+
+	t.Run("Unknown Services", func(t *testing.T) {
+		cfg := load(t, `
+services:
+  enabled: [database, cache]
+  settings:
+    search: {}
+`)
+
+		_, err := registry.Build(nil, cfg)
+		if !errors.Is(err, manager.ErrInvalidConfig) || !strings.Contains(err.Error(), "[cache search]") {
+			t.Errorf("Expected an invalid config naming cache and search, got %v", err)
+		}
+	})
+
+	t.Run("Disabled Dependency", func(t *testing.T) {
+		err := registry.Validate(manager.Config{Enabled: []manager.ServiceName{"http"}})
+		if !errors.Is(err, manager.ErrInvalidConfig) || !strings.Contains(err.Error(), "disabled service database") {
+			t.Errorf("Expected an invalid config naming the disabled dependency, got %v", err)
+		}
+	})
+
+	t.Run("Invalid Settings", func(t *testing.T) {
+		cfg := manager.Config{
+			Enabled:  []manager.ServiceName{"database", "http"},
+			Settings: map[manager.ServiceName]json.RawMessage{"http": json.RawMessage(`{"address": ":8080"}`)},
+		}
+
+		if _, err := registry.Build(nil, cfg); err == nil || !strings.Contains(err.Error(), "error creating service http") {
+			t.Errorf("Expected unknown settings to be rejected, got %v", err)
+		}
+	})
+}
+
+type LoggingService struct {
+	SimpleService
+	logger logger.Logger
+}
+
+func (s *LoggingService) SetLogger(l logger.Logger) {
+	s.logger = l
+}
+
+func (s *LoggingService) Start() error {
+	s.logger.Info("Connected", map[string]interface{}{"host": "localhost"})
+	return nil
+}
+
+func TestStructuredLogging(t *testing.T) {
+	logs := &lockedBuffer{}
+	serviceManager := manager.New(&manager.Options{Logger: logger.New(logger.WithWriters(logs))})
+	serviceManager.Add("database", &LoggingService{}, manager.InPhase(manager.PhaseInfra))
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+	serviceManager.Stop()
+
+	entries := map[string]map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to decode log entry %s: %v", line, err)
+		}
+		entries[entry["message"].(string)] = entry
+	}
+
+	for _, message := range []string{"Connected", "Service started successfully", "Service stopped successfully"} {
+		entry, ok := entries[message]
+		if !ok {
+			t.Errorf("Expected log entry %q, got %v", message, entries)
+			continue
+		}
+
+		if entry["service"] != "database" || entry["phase"] != "infra" {
+			t.Errorf("Expected entry %q to have service and phase fields, got %v", message, entry)
+		}
+	}
+
+	if entries["Connected"]["host"] != "localhost" {
+		t.Errorf("Expected the fields of the service to be logged, got %v", entries["Connected"])
+	}
+
+	if _, ok := entries["Service started successfully"]["duration"]; !ok {
+		t.Errorf("Expected the start to be logged with its duration, got %v", entries["Service started successfully"])
+	}
+}
@@ -0,0 +1,158 @@
+package managertest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/manager"
+)
+
+type (
+	// FakeClock is a manager.Clock whose time only moves when Advance is called. Timers and
+	// tickers fire while the clock is advanced past their deadlines.
+	FakeClock struct {
+		mu      sync.Mutex
+		changed *sync.Cond
+		now     time.Time
+		waiters []*waiter
+	}
+
+	waiter struct {
+		deadline time.Time
+		period   time.Duration
+		ch       chan time.Time
+	}
+
+	// fakeTimer implements both manager.Timer and manager.Ticker.
+	fakeTimer struct {
+		clock  *FakeClock
+		waiter *waiter
+	}
+)
+
+// NewFakeClock creates a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer returns a Timer which fires once the clock advanced by d.
+// It stays pending until it fires or is stopped.
+func (c *FakeClock) NewTimer(d time.Duration) manager.Timer {
+	return &fakeTimer{clock: c, waiter: c.add(d, 0)}
+}
+
+// NewTicker returns a Ticker which ticks every d while the clock is advanced.
+// Like time.Ticker, it drops ticks a slow receiver is not ready for.
+func (c *FakeClock) NewTicker(d time.Duration) manager.Ticker {
+	if d <= 0 {
+		panic("managertest: non-positive interval for NewTicker")
+	}
+
+	return &fakeTimer{clock: c, waiter: c.add(d, d)}
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers which are due on the way.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool {
+			return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+		})
+
+		if len(c.waiters) == 0 || c.waiters[0].deadline.After(end) {
+			break
+		}
+
+		w := c.waiters[0]
+		c.now = w.deadline
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+
+		if w.period > 0 {
+			w.deadline = w.deadline.Add(w.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+
+	c.now = end
+	c.changed.Broadcast()
+}
+
+// Waiters returns the number of pending timers and tickers. Timers and tickers which were
+// stopped or have fired are not pending.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+// BlockUntil waits until at least n timers and tickers are pending, e.g. until a supervisor
+// waits for its restart backoff, so Advance is not called too early. Only timers and tickers
+// which are still waited for count, as callers stop those they give up on.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.changed.Wait()
+	}
+}
+
+// add registers a waiter due after d, repeating every period if it is positive.
+func (c *FakeClock) add(d, period time.Duration) *waiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &waiter{deadline: c.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- c.now
+		if period == 0 {
+			return w
+		}
+		w.deadline = c.now.Add(period)
+	}
+
+	c.waiters = append(c.waiters, w)
+	c.changed.Broadcast()
+	return w
+}
+
+// remove unregisters a waiter.
+func (c *FakeClock) remove(w *waiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+	c.changed.Broadcast()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.waiter.ch
+}
+
+func (t *fakeTimer) Stop() {
+	t.clock.remove(t.waiter)
+}
@@ -0,0 +1,14 @@
+// Package managertest provides fake services, a recorder of lifecycle calls and a fake
+// clock for testing code built on the service manager deterministically and under -race.
+package managertest
+
+import "errors"
+
+// ErrInjected is returned by fake services configured to fail without a specific error.
+var ErrInjected = errors.New("injected failure")
+
+// TestingT is the subset of testing.TB used by the assertions.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
@@ -0,0 +1,193 @@
+package managertest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/logger"
+	"github.com/flowshot-io/x/pkg/manager"
+	"github.com/flowshot-io/x/pkg/manager/managertest"
+)
+
+var epoch = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	recorder := managertest.NewRecorder()
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp(), Sequential: true})
+	serviceManager.AddContext("database", managertest.NewService("database", managertest.WithRecorder(recorder)))
+	serviceManager.AddContext("queue", managertest.NewService("queue", managertest.WithRecorder(recorder)), manager.DependsOn("database"))
+	serviceManager.AddContext("cache", managertest.NewService("cache", managertest.WithRecorder(recorder)))
+	serviceManager.AddContext("http", managertest.NewService("http", managertest.WithRecorder(recorder)), manager.DependsOn("queue", "cache"))
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+
+	if err := serviceManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+
+	recorder.AssertCalls(t,
+		"cache:start", "database:start", "queue:start", "http:start",
+		"http:stop", "queue:stop", "cache:stop", "database:stop",
+	)
+	recorder.AssertOrder(t, "database:start", "http:start", "http:stop", "database:stop")
+}
+
+func TestFailOnStart(t *testing.T) {
+	recorder := managertest.NewRecorder()
+	database := managertest.NewService("database", managertest.WithRecorder(recorder))
+	queue := managertest.NewService("queue", managertest.WithRecorder(recorder), managertest.FailOnStart(1, nil))
+
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+	serviceManager.AddContext("database", database)
+	serviceManager.AddContext("queue", queue, manager.DependsOn("database"))
+
+	if err := serviceManager.Start(); !errors.Is(err, managertest.ErrInjected) {
+		t.Fatalf("Expected the injected failure, got %v", err)
+	}
+
+	recorder.AssertCalls(t, "database:start", "queue:start", "database:stop")
+	if database.Running() || queue.Running() {
+		t.Errorf("Expected no service to be running after the rollback")
+	}
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Expected the second start to succeed, got %v", err)
+	}
+
+	if queue.Starts() != 2 || !queue.Running() {
+		t.Errorf("Expected queue to run after its second start, got %d starts", queue.Starts())
+	}
+
+	serviceManager.Stop()
+}
+
+func TestHang(t *testing.T) {
+	s := managertest.NewService("hanging", managertest.HangOnStart())
+	defer s.Release()
+
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp(), StartTimeout: 10 * time.Millisecond})
+	serviceManager.AddContext("hanging", s)
+
+	var timeoutErr *manager.TimeoutError
+	if err := serviceManager.Start(); !errors.As(err, &timeoutErr) {
+		t.Fatalf("Expected a TimeoutError, got %v", err)
+	}
+}
+
+func TestRestartWithFakeClock(t *testing.T) {
+	clock := managertest.NewFakeClock(epoch)
+	recorder := managertest.NewRecorder()
+	s := managertest.NewService("worker", managertest.WithRecorder(recorder), managertest.FailOnStart(2, nil))
+
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp(), Clock: clock})
+	serviceManager.AddContext("worker", s, manager.WithRestartPolicy(manager.RestartPolicy{
+		Mode:    manager.RestartOnFailure,
+		Backoff: time.Second,
+	}))
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+	defer serviceManager.Stop()
+
+	if since := serviceManager.Status()[0].Since; !since.Equal(epoch) {
+		t.Errorf("Expected status timestamps from the fake clock, got %v", since)
+	}
+
+	s.Exit(errors.New("connection lost"))
+
+	// The health ticker and the first backoff.
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
+
+	// The second start fails, so the backoff doubles.
+	clock.BlockUntil(2)
+	clock.Advance(time.Second)
+	if starts := s.Starts(); starts != 2 {
+		t.Fatalf("Expected no restart before the backoff elapsed, got %d starts", starts)
+	}
+
+	clock.Advance(time.Second)
+	waitFor(t, s.Running)
+
+	recorder.AssertCalls(t, "worker:start", "worker:exit", "worker:stop", "worker:start", "worker:stop", "worker:start")
+	if restarts := serviceManager.Status()[0].Restarts; restarts != 2 {
+		t.Errorf("Expected 2 restarts, got %d", restarts)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	clock := managertest.NewFakeClock(epoch)
+
+	timer := clock.NewTimer(time.Minute)
+	abandoned := clock.NewTimer(time.Hour)
+	ticker := clock.NewTicker(20 * time.Second)
+
+	clock.Advance(30 * time.Second)
+	if now := <-ticker.C(); !now.Equal(epoch.Add(20 * time.Second)) {
+		t.Errorf("Expected a tick after 20s, got %v", now)
+	}
+
+	select {
+	case <-timer.C():
+		t.Fatalf("Expected the timer not to fire early")
+	default:
+	}
+
+	clock.Advance(30 * time.Second)
+	if now := <-timer.C(); !now.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("Expected the timer to fire after a minute, got %v", now)
+	}
+
+	ticker.Stop()
+	abandoned.Stop()
+	if waiters := clock.Waiters(); waiters != 0 {
+		t.Errorf("Expected no pending waiters, got %d", waiters)
+	}
+
+	if now := clock.Now(); !now.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("Expected the clock to have advanced a minute, got %v", now)
+	}
+}
+
+func TestServiceHooks(t *testing.T) {
+	failure := errors.New("not ready")
+	s := managertest.NewService("hooked", managertest.OnStart(func(ctx context.Context, attempt int) error {
+		if attempt == 1 {
+			return failure
+		}
+		return nil
+	}), managertest.WithStopError(failure))
+
+	if err := s.Start(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("Expected the first start to fail, got %v", err)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Expected the second start to succeed, got %v", err)
+	}
+
+	if err := s.Stop(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("Expected the stop error, got %v", err)
+	}
+
+	if s.Running() {
+		t.Errorf("Expected the service to count as stopped")
+	}
+}
@@ -0,0 +1,92 @@
+package managertest
+
+import (
+	"sync"
+
+	"github.com/flowshot-io/x/pkg/manager"
+)
+
+// Recorder records the lifecycle calls of fake services in the order they were made.
+// Calls are recorded as "<service>:<op>", e.g. "database:start".
+type Recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Record appends a call of the operation on the service.
+func (r *Recorder) Record(service manager.ServiceName, op string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, string(service)+":"+op)
+}
+
+// Calls returns a copy of the recorded calls.
+func (r *Recorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.calls...)
+}
+
+// Reset forgets all recorded calls.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = nil
+}
+
+// AssertCalls reports an error unless exactly the expected calls were recorded, in order.
+func (r *Recorder) AssertCalls(t TestingT, expected ...string) {
+	t.Helper()
+
+	calls := r.Calls()
+	if len(calls) != len(expected) {
+		t.Errorf("Expected calls %v, got %v", expected, calls)
+		return
+	}
+
+	for i := range calls {
+		if calls[i] != expected[i] {
+			t.Errorf("Expected calls %v, got %v", expected, calls)
+			return
+		}
+	}
+}
+
+// AssertOrder reports an error unless the expected calls were recorded in the given order.
+// Other calls may be recorded in between, so services started concurrently can be checked
+// against the order their dependencies impose.
+func (r *Recorder) AssertOrder(t TestingT, expected ...string) {
+	t.Helper()
+
+	calls := r.Calls()
+	next := 0
+	for _, call := range calls {
+		if next < len(expected) && call == expected[next] {
+			next++
+		}
+	}
+
+	if next < len(expected) {
+		t.Errorf("Expected calls in order %v, got %v", expected, calls)
+	}
+}
+
+// AssertNotCalled reports an error if the call was recorded.
+func (r *Recorder) AssertNotCalled(t TestingT, call string) {
+	t.Helper()
+
+	for _, c := range r.Calls() {
+		if c == call {
+			t.Errorf("Expected no call %s, got %v", call, r.Calls())
+			return
+		}
+	}
+}
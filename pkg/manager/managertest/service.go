@@ -0,0 +1,309 @@
+package managertest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/manager"
+)
+
+type (
+	// Service is a fake manager.ContextService whose behavior is configured with options.
+	// It records its calls with its Recorder and keeps running in the background after Start
+	// like a real service, until it is stopped or Exit is called.
+	Service struct {
+		name      manager.ServiceName
+		recorder  *Recorder
+		clock     manager.Clock
+		startHook func(ctx context.Context, attempt int) error
+		stopHook  func(ctx context.Context) error
+
+		startDelay  time.Duration
+		stopDelay   time.Duration
+		failOn      map[int]error
+		stopErr     error
+		startPanic  interface{}
+		stopPanic   interface{}
+		hangOnStart bool
+		hangOnStop  bool
+		release     chan struct{}
+		releaseOnce sync.Once
+
+		mu      sync.Mutex
+		starts  int
+		stops   int
+		running bool
+		done    chan error
+	}
+
+	// Option configures a fake Service.
+	Option func(*Service)
+)
+
+// WithRecorder records the calls of the service with the recorder.
+func WithRecorder(r *Recorder) Option {
+	return func(s *Service) {
+		s.recorder = r
+	}
+}
+
+// WithClock makes the delays of the service wait on the clock instead of the real time.
+func WithClock(c manager.Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+	}
+}
+
+// WithStartDelay delays Start by d, or until its context is done.
+func WithStartDelay(d time.Duration) Option {
+	return func(s *Service) {
+		s.startDelay = d
+	}
+}
+
+// WithStopDelay delays Stop by d, or until its context is done.
+func WithStopDelay(d time.Duration) Option {
+	return func(s *Service) {
+		s.stopDelay = d
+	}
+}
+
+// FailOnStart makes the nth call of Start fail with err (ErrInjected if nil), counting from 1.
+// It may be used multiple times to fail several attempts.
+func FailOnStart(n int, err error) Option {
+	return func(s *Service) {
+		if err == nil {
+			err = ErrInjected
+		}
+		s.failOn[n] = err
+	}
+}
+
+// WithStopError makes every call of Stop fail with err.
+func WithStopError(err error) Option {
+	return func(s *Service) {
+		s.stopErr = err
+	}
+}
+
+// PanicOnStart makes Start panic with the value.
+func PanicOnStart(value interface{}) Option {
+	return func(s *Service) {
+		s.startPanic = value
+	}
+}
+
+// PanicOnStop makes Stop panic with the value.
+func PanicOnStop(value interface{}) Option {
+	return func(s *Service) {
+		s.stopPanic = value
+	}
+}
+
+// HangOnStart makes Start block until its context is done or Release is called.
+func HangOnStart() Option {
+	return func(s *Service) {
+		s.hangOnStart = true
+	}
+}
+
+// HangOnStop makes Stop block until its context is done or Release is called.
+func HangOnStop() Option {
+	return func(s *Service) {
+		s.hangOnStop = true
+	}
+}
+
+// OnStart calls fn at the end of every Start with the number of the attempt, counting from 1.
+// An error returned by fn fails the attempt.
+func OnStart(fn func(ctx context.Context, attempt int) error) Option {
+	return func(s *Service) {
+		s.startHook = fn
+	}
+}
+
+// OnStop calls fn at the end of every Stop. An error returned by fn fails the call.
+func OnStop(fn func(ctx context.Context) error) Option {
+	return func(s *Service) {
+		s.stopHook = fn
+	}
+}
+
+// NewService creates a fake service with the given name, which it records its calls under.
+func NewService(name manager.ServiceName, opts ...Option) *Service {
+	s := &Service{
+		name:    name,
+		clock:   manager.RealClock(),
+		failOn:  make(map[int]error),
+		release: make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Name returns the name of the service.
+func (s *Service) Name() manager.ServiceName {
+	return s.name
+}
+
+// Start starts the service according to its options.
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.starts++
+	attempt := s.starts
+	s.mu.Unlock()
+
+	s.record(manager.OpStart)
+
+	if s.startPanic != nil {
+		panic(s.startPanic)
+	}
+
+	if err := s.wait(ctx, s.startDelay, s.hangOnStart); err != nil {
+		return err
+	}
+
+	if err, ok := s.failOn[attempt]; ok {
+		return err
+	}
+
+	if s.startHook != nil {
+		if err := s.startHook(ctx, attempt); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.running = true
+	s.done = make(chan error, 1)
+	s.mu.Unlock()
+	return nil
+}
+
+// Stop stops the service according to its options. The service counts as stopped even if
+// Stop fails.
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stops++
+	s.mu.Unlock()
+
+	s.record(manager.OpStop)
+
+	if s.stopPanic != nil {
+		panic(s.stopPanic)
+	}
+
+	err := s.wait(ctx, s.stopDelay, s.hangOnStop)
+	s.exit(nil)
+
+	if err != nil {
+		return err
+	}
+
+	if s.stopHook != nil {
+		if err := s.stopHook(ctx); err != nil {
+			return err
+		}
+	}
+
+	return s.stopErr
+}
+
+// Done returns the channel the manager supervises the running service with.
+func (s *Service) Done() <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.done
+}
+
+// Exit makes the running service exit on its own with err, or cleanly if err is nil.
+func (s *Service) Exit(err error) {
+	s.record("exit")
+	s.exit(err)
+}
+
+// Release unblocks the Start and Stop calls hanging now and in the future.
+func (s *Service) Release() {
+	s.releaseOnce.Do(func() {
+		close(s.release)
+	})
+}
+
+// Running reports whether the service started and did not stop or exit since.
+func (s *Service) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running
+}
+
+// Starts returns the number of calls of Start.
+func (s *Service) Starts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.starts
+}
+
+// Stops returns the number of calls of Stop.
+func (s *Service) Stops() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stops
+}
+
+// exit ends the current run of the service with err.
+func (s *Service) exit(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+
+	s.running = false
+	if err != nil {
+		s.done <- err
+	}
+	close(s.done)
+}
+
+// wait blocks for the delay, or until the service is released if hang is set, and returns
+// the error of the context if it is done first.
+func (s *Service) wait(ctx context.Context, delay time.Duration, hang bool) error {
+	if hang {
+		select {
+		case <-s.release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := s.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Service) record(op string) {
+	if s.recorder != nil {
+		s.recorder.Record(s.name, op)
+	}
+}
@@ -0,0 +1,55 @@
+package manager
+
+import "context"
+
+type (
+	// contextLifecycle is implemented by services which also offer context-aware Start and
+	// Stop methods, such as ServiceManager.
+	contextLifecycle interface {
+		StartContext(ctx context.Context) error
+		StopContext(ctx context.Context) error
+	}
+
+	// statusReporter is implemented by services which report the status of services of
+	// their own, such as ServiceManager.
+	statusReporter interface {
+		Status() []ServiceStatus
+	}
+
+	// eventSource is implemented by services which publish lifecycle events of services of
+	// their own, such as ServiceManager.
+	eventSource interface {
+		Subscribe(buffer int) (<-chan Event, func())
+	}
+)
+
+// Done returns a channel receiving the failure of a service which the manager did not
+// recover from. It makes a ServiceManager added to another one supervised by its parent,
+// so the failure is handled according to the restart policy of the nested manager.
+// Once Done was called, the manager leaves stopping its services after a failure to the caller.
+func (sm *ServiceManager) Done() <-chan error {
+	sm.opMutex.Lock()
+	defer sm.opMutex.Unlock()
+
+	sm.supervised = true
+	return sm.failed
+}
+
+// forwardEvents republishes the events of a nested service, such as a nested ServiceManager,
+// naming the services by their path, e.g. "subsystem/database".
+func (sm *ServiceManager) forwardEvents(entry *serviceEntry) {
+	source, ok := underlying(entry.service).(eventSource)
+	if !ok {
+		return
+	}
+
+	events, cancel := source.Subscribe(0)
+	entry.unsubscribe = cancel
+
+	go func() {
+		for event := range events {
+			event.Service = entry.name + "/" + event.Service
+			sm.events.publish(event)
+		}
+	}()
+}
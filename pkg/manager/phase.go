@@ -0,0 +1,114 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrPhaseOrder is returned when a service depends on a service in a later phase.
+var ErrPhaseOrder = errors.New("dependency in later phase")
+
+// Phase groups services which are started together. Phases are started in ascending order
+// of priority, phases with equal priority ordered by name, and every service of a phase has
+// started before the next phase begins. They are stopped in reverse order.
+type Phase struct {
+	Name     string
+	Priority int
+}
+
+var (
+	// PhaseInfra is the phase for infrastructure such as databases, caches and queues.
+	PhaseInfra = Phase{Name: "infra", Priority: 100}
+	// PhaseCore is the phase for the core services of an application. Services are in
+	// PhaseCore unless InPhase is used.
+	PhaseCore = Phase{Name: "core", Priority: 200}
+	// PhaseIngress is the phase for services receiving traffic, such as HTTP servers and
+	// workers, which should only start once everything they use is running.
+	PhaseIngress = Phase{Name: "ingress", Priority: 300}
+)
+
+// phasePlan holds the start waves of the services of a phase.
+type phasePlan struct {
+	phase Phase
+	waves [][]ServiceName
+}
+
+// InPhase places the service in a phase.
+func InPhase(phase Phase) ServiceOption {
+	return func(e *serviceEntry) {
+		e.phase = phase
+	}
+}
+
+// startPlan orders the services into phases and every phase into start waves.
+// Services may depend on services in the same or an earlier phase.
+func startPlan(services map[ServiceName]*serviceEntry) ([]phasePlan, error) {
+	byPhase := make(map[Phase]map[ServiceName]*serviceEntry)
+	for name, entry := range services {
+		if byPhase[entry.phase] == nil {
+			byPhase[entry.phase] = make(map[ServiceName]*serviceEntry)
+		}
+		byPhase[entry.phase][name] = entry
+	}
+
+	phases := make([]Phase, 0, len(byPhase))
+	for phase := range byPhase {
+		phases = append(phases, phase)
+	}
+	sortPhases(phases)
+
+	order := make(map[Phase]int, len(phases))
+	for i, phase := range phases {
+		order[phase] = i
+	}
+
+	names := make([]ServiceName, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sortServiceNames(names)
+
+	for _, name := range names {
+		entry := services[name]
+		for _, dep := range entry.dependencies {
+			depEntry, ok := services[dep]
+			if !ok {
+				return nil, fmt.Errorf("%w: service %s depends on %s", ErrMissingDependency, name, dep)
+			}
+			if order[depEntry.phase] > order[entry.phase] {
+				return nil, fmt.Errorf("%w: service %s in phase %s depends on %s in phase %s", ErrPhaseOrder, name, entry.phase.Name, dep, depEntry.phase.Name)
+			}
+		}
+	}
+
+	plan := make([]phasePlan, 0, len(phases))
+	for _, phase := range phases {
+		waves, err := startWaves(byPhase[phase])
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, phasePlan{phase: phase, waves: waves})
+	}
+
+	return plan, nil
+}
+
+// services returns the names of the services of the phase in start order.
+func (p phasePlan) services() []ServiceName {
+	var names []ServiceName
+	for _, wave := range p.waves {
+		names = append(names, wave...)
+	}
+
+	return names
+}
+
+func sortPhases(phases []Phase) {
+	sort.Slice(phases, func(i, j int) bool {
+		if phases[i].Priority != phases[j].Priority {
+			return phases[i].Priority < phases[j].Priority
+		}
+		return phases[i].Name < phases[j].Name
+	})
+}
@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrFactoryRegistered is returned when registering a second factory for a service name.
+	ErrFactoryRegistered = errors.New("factory already registered")
+	// ErrInvalidConfig is returned when a Config names services that were not registered or
+	// enables services whose dependencies are disabled.
+	ErrInvalidConfig = errors.New("invalid service config")
+)
+
+type (
+	// Config is the configuration section assembling a ServiceManager from a Registry. It is
+	// meant to be embedded in the configuration loaded with config.Load, e.g.
+	//
+	//	services:
+	//	  enabled: [database, http]
+	//	  settings:
+	//	    http:
+	//	      addr: ":8080"
+	//
+	// Enabled lists the services to add, and Settings holds the configuration passed to the
+	// factories of the services. Settings of registered services which are not enabled are
+	// allowed, so services can be toggled without removing their settings.
+	Config struct {
+		Enabled  []ServiceName                   `json:"enabled" validate:"unique,dive,required"`
+		Settings map[ServiceName]json.RawMessage `json:"settings,omitempty"`
+	}
+
+	// Settings holds the configuration of a single service.
+	Settings json.RawMessage
+
+	// Factory creates a service from its settings.
+	Factory func(settings Settings) (ContextService, error)
+
+	// Registry holds the factories of the services an application can run, so the
+	// services which are added to a ServiceManager are chosen by configuration.
+	Registry struct {
+		mu        sync.RWMutex
+		factories map[ServiceName]registration
+	}
+
+	// registration holds a factory together with the options the service is added with.
+	registration struct {
+		factory Factory
+		opts    []ServiceOption
+	}
+)
+
+// Decode decodes the settings into v, rejecting fields v does not have. Empty settings
+// leave v unchanged.
+func (s Settings) Decode(v interface{}) error {
+	if len(s) == 0 {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(s))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[ServiceName]registration)}
+}
+
+// Register registers the factory of the service with the given name. The options are
+// applied when the service is added, e.g. to declare its dependencies.
+func (r *Registry) Register(name ServiceName, factory Factory, opts ...ServiceOption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("%w: %s", ErrFactoryRegistered, name)
+	}
+
+	r.factories[name] = registration{factory: factory, opts: opts}
+	return nil
+}
+
+// Names returns the names of the registered services, ordered by name.
+func (r *Registry) Names() []ServiceName {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.names()
+}
+
+// Validate checks that the config only names registered services and that the
+// dependencies of every enabled service are enabled.
+func (r *Registry) Validate(cfg Config) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	enabled := make(map[ServiceName]bool, len(cfg.Enabled))
+	var unknown []ServiceName
+	for _, name := range cfg.Enabled {
+		if enabled[name] {
+			return fmt.Errorf("%w: service %s is enabled twice", ErrInvalidConfig, name)
+		}
+		enabled[name] = true
+
+		if _, ok := r.factories[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	for name := range cfg.Settings {
+		if _, ok := r.factories[name]; !ok && !enabled[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sortServiceNames(unknown)
+		return fmt.Errorf("%w: unknown services %v, registered services are %v", ErrInvalidConfig, unknown, r.names())
+	}
+
+	var messages []string
+	for _, name := range cfg.Enabled {
+		for _, dep := range r.factories[name].dependencies() {
+			if !enabled[dep] {
+				messages = append(messages, fmt.Sprintf("service %s depends on disabled service %s", name, dep))
+			}
+		}
+	}
+
+	if len(messages) > 0 {
+		sort.Strings(messages)
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, messages)
+	}
+
+	return nil
+}
+
+// Build validates the config and creates a ServiceManager with the options, adding the
+// enabled services created by their factories.
+func (r *Registry) Build(opts *Options, cfg Config) (*ServiceManager, error) {
+	if err := r.Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	registrations := make([]registration, len(cfg.Enabled))
+	for i, name := range cfg.Enabled {
+		registrations[i] = r.factories[name]
+	}
+	r.mu.RUnlock()
+
+	services := make([]ContextService, len(cfg.Enabled))
+	for i, name := range cfg.Enabled {
+		service, err := registrations[i].factory(Settings(cfg.Settings[name]))
+		if err != nil {
+			return nil, fmt.Errorf("error creating service %s: %w", name, err)
+		}
+		services[i] = service
+	}
+
+	sm := New(opts)
+	for i, name := range cfg.Enabled {
+		if err := sm.AddContext(name, services[i], registrations[i].opts...); err != nil {
+			return nil, err
+		}
+	}
+
+	return sm, nil
+}
+
+// names returns the names of the registered services; the caller holds the lock.
+func (r *Registry) names() []ServiceName {
+	names := make([]ServiceName, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sortServiceNames(names)
+
+	return names
+}
+
+// dependencies returns the dependencies declared by the options of the registration.
+func (reg registration) dependencies() []ServiceName {
+	var entry serviceEntry
+	for _, opt := range reg.opts {
+		opt(&entry)
+	}
+
+	return entry.dependencies
+}
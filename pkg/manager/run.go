@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// DefaultShutdownTimeout is the time Run allows for a graceful shutdown by default.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ErrForcedShutdown is returned by Run when a second signal interrupted the graceful shutdown
+// and the configured exit function returned.
+var ErrForcedShutdown = errors.New("shutdown forced by signal")
+
+// Run starts all services and blocks until a shutdown signal is received, the context is
+// done or a service fails without being restarted, then stops all services within the
+// shutdown timeout.
+// A signal during the start cancels the start, so a hanging service cannot block shutdown;
+// the services started so far are then stopped within the shutdown timeout.
+// A second signal during the start or the graceful shutdown exits the process immediately.
+// Run returns the error of the failed service, if any, or else the error from stopping.
+func (sm *ServiceManager) Run(ctx context.Context) error {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, sm.signals...)
+	defer signal.Stop(signals)
+
+	sm.setRunning(true)
+	defer sm.setRunning(false)
+
+	sig, err := sm.startInterruptible(ctx, signals)
+	if err != nil {
+		return err
+	}
+
+	var cause error
+	if sig != nil {
+		sm.logger.Info("Received signal, shutting down", map[string]interface{}{
+			"signal": sig.String(),
+		})
+	} else {
+		select {
+		case sig := <-signals:
+			sm.logger.Info("Received signal, shutting down", map[string]interface{}{
+				"signal": sig.String(),
+			})
+		case <-ctx.Done():
+			sm.logger.Info("Context done, shutting down", map[string]interface{}{
+				"reason": ctx.Err().Error(),
+			})
+		case cause = <-sm.failed:
+			sm.logger.Error("Service failed, shutting down", map[string]interface{}{
+				"error": cause.Error(),
+			})
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), sm.shutdownTimeout)
+	defer cancel()
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- sm.StopContext(stopCtx)
+	}()
+
+	var stopErr error
+	select {
+	case stopErr = <-stopped:
+	case sig := <-signals:
+		sm.logger.Warn("Received second signal, forcing exit", map[string]interface{}{
+			"signal": sig.String(),
+		})
+		sm.exit(1)
+		return ErrForcedShutdown
+	}
+
+	if cause != nil {
+		if stopErr != nil {
+			return fmt.Errorf("%w (error during shutdown: %v)", cause, stopErr)
+		}
+		return cause
+	}
+
+	return stopErr
+}
+
+// startInterruptible starts all services and cancels the start when a signal arrives first.
+// The stopping of already started services after a cancelled start is bounded by the shutdown
+// timeout, and a second signal forces an exit as during the graceful shutdown. It returns the
+// signal received while starting, if any.
+func (sm *ServiceManager) startInterruptible(ctx context.Context, signals <-chan os.Signal) (os.Signal, error) {
+	startCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	started := make(chan error, 1)
+	go func() {
+		started <- sm.start(startCtx, sm.shutdownTimeout)
+	}()
+
+	var interrupted os.Signal
+	for {
+		select {
+		case err := <-started:
+			return interrupted, err
+		case sig := <-signals:
+			if interrupted != nil {
+				sm.logger.Warn("Received second signal, forcing exit", map[string]interface{}{
+					"signal": sig.String(),
+				})
+				sm.exit(1)
+				return interrupted, ErrForcedShutdown
+			}
+
+			sm.logger.Info("Received signal, cancelling start", map[string]interface{}{
+				"signal": sig.String(),
+			})
+			interrupted = sig
+			cancel()
+		}
+	}
+}
+
+// setRunning records whether Run is driving the manager and thus handles escalated failures.
+func (sm *ServiceManager) setRunning(running bool) {
+	sm.opMutex.Lock()
+	defer sm.opMutex.Unlock()
+
+	sm.running = running
+}
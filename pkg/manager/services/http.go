@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/manager"
+)
+
+// DefaultShutdownTimeout is the time an HTTPServer allows in-flight requests to complete by default.
+const DefaultShutdownTimeout = 10 * time.Second
+
+type (
+	// HTTPOption defines a function which configures an HTTPServer.
+	HTTPOption func(*HTTPServer)
+
+	// HTTPServer serves HTTP as a service.
+	// Stop shuts the server down gracefully, waiting for in-flight requests to complete
+	// within the shutdown timeout before closing the remaining connections.
+	// A new http.Server is created on every start, so the service can be restarted.
+	HTTPServer struct {
+		addr            string
+		handler         http.Handler
+		shutdownTimeout time.Duration
+		configure       func(*http.Server)
+		certFile        string
+		keyFile         string
+
+		mu       sync.Mutex
+		server   *http.Server
+		listener net.Listener
+		done     chan error
+	}
+)
+
+// WithShutdownTimeout sets the time in-flight requests have to complete when the server is
+// stopped (defaults to DefaultShutdownTimeout).
+func WithShutdownTimeout(d time.Duration) HTTPOption {
+	return func(s *HTTPServer) {
+		s.shutdownTimeout = d
+	}
+}
+
+// WithTLS serves HTTPS using the certificate and key files.
+func WithTLS(certFile, keyFile string) HTTPOption {
+	return func(s *HTTPServer) {
+		s.certFile = certFile
+		s.keyFile = keyFile
+	}
+}
+
+// WithServerConfig calls configure with every http.Server before it starts serving, e.g. to
+// set timeouts or a TLS configuration.
+func WithServerConfig(configure func(*http.Server)) HTTPOption {
+	return func(s *HTTPServer) {
+		s.configure = configure
+	}
+}
+
+// NewHTTPServer creates a service serving handler on the TCP address.
+func NewHTTPServer(addr string, handler http.Handler, opts ...HTTPOption) *HTTPServer {
+	s := &HTTPServer{
+		addr:            addr,
+		handler:         handler,
+		shutdownTimeout: DefaultShutdownTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Start listens on the address and serves requests in the background.
+// It returns an error if the address cannot be listened on.
+func (s *HTTPServer) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		return manager.ErrServiceStarted
+	}
+
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Addr: s.addr, Handler: s.handler}
+	if s.configure != nil {
+		s.configure(server)
+	}
+
+	done := make(chan error, 1)
+	s.server, s.listener, s.done = server, listener, done
+
+	go func() {
+		var err error
+		if s.certFile != "" || s.keyFile != "" {
+			err = server.ServeTLS(listener, s.certFile, s.keyFile)
+		} else {
+			err = server.Serve(listener)
+		}
+
+		if !errors.Is(err, http.ErrServerClosed) {
+			done <- err
+		}
+		close(done)
+	}()
+
+	return nil
+}
+
+// Stop shuts the server down gracefully, closing the remaining connections once the
+// shutdown timeout has passed.
+func (s *HTTPServer) Stop() error {
+	s.mu.Lock()
+	server := s.server
+	s.server = nil
+	s.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Done returns a channel receiving the error which made the server stop serving, or closed
+// when the server was shut down.
+func (s *HTTPServer) Done() <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.done
+}
+
+// Addr returns the address the server listens on once started, or the configured address.
+func (s *HTTPServer) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+
+	return s.addr
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+type (
+	// Schedule decides when a job runs next. It matches the Schedule interface of common
+	// cron libraries, so cron expressions can be used as a schedule.
+	Schedule interface {
+		Next(t time.Time) time.Time
+	}
+
+	// JobOption defines a function which configures a Job.
+	JobOption func(*Job)
+
+	// Job runs a function on a schedule as a service.
+	// By default an error returned by the function ends the job and is reported through
+	// Done, so the ServiceManager can restart it according to its restart policy.
+	Job struct {
+		*Runner
+
+		schedule  Schedule
+		fn        func(ctx context.Context) error
+		jitter    time.Duration
+		immediate bool
+		onError   func(err error)
+	}
+
+	// interval is a Schedule running at a fixed interval.
+	interval time.Duration
+)
+
+// Every returns a Schedule running a job at a fixed interval.
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// WithJitter delays every run by a random duration up to d, so replicas running the same
+// job do not all run it at the same time.
+func WithJitter(d time.Duration) JobOption {
+	return func(j *Job) {
+		j.jitter = d
+	}
+}
+
+// WithRunImmediately runs the job as soon as it is started instead of waiting for the
+// first scheduled time.
+func WithRunImmediately() JobOption {
+	return func(j *Job) {
+		j.immediate = true
+	}
+}
+
+// WithErrorHandler keeps the job running when the function returns an error, passing the
+// error to handler instead.
+func WithErrorHandler(handler func(err error)) JobOption {
+	return func(j *Job) {
+		j.onError = handler
+	}
+}
+
+// NewJob creates a service running fn on the schedule.
+// The context passed to fn is cancelled when the service is stopped.
+func NewJob(schedule Schedule, fn func(ctx context.Context) error, opts ...JobOption) *Job {
+	j := &Job{schedule: schedule, fn: fn}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	j.Runner = NewRunner(j.run)
+	return j
+}
+
+func (j *Job) run(ctx context.Context) error {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	next := j.schedule.Next(time.Now())
+	if j.immediate {
+		next = time.Now()
+	}
+
+	for {
+		delay := time.Until(next)
+		if j.jitter > 0 {
+			delay += time.Duration(random.Int63n(int64(j.jitter)))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+
+		if err := j.fn(ctx); err != nil && ctx.Err() == nil {
+			if j.onError == nil {
+				return err
+			}
+			j.onError(err)
+		}
+
+		next = j.schedule.Next(time.Now())
+	}
+}
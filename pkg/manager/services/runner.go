@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/flowshot-io/x/pkg/manager"
+)
+
+// Runner runs a function in a goroutine as a service.
+// The function is started with a context which is cancelled when the service is stopped.
+// Returning from the function ends the service: a non-nil error is reported through Done,
+// so the ServiceManager can restart the service according to its restart policy.
+type Runner struct {
+	fn func(ctx context.Context) error
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan error
+	exited chan struct{}
+}
+
+// NewRunner creates a service running fn.
+func NewRunner(fn func(ctx context.Context) error) *Runner {
+	return &Runner{fn: fn}
+}
+
+// Start runs the function in a new goroutine.
+func (r *Runner) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return manager.ErrServiceStarted
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	exited := make(chan struct{})
+	r.cancel, r.done, r.exited = cancel, done, exited
+
+	go func() {
+		defer close(exited)
+
+		// Errors caused by stopping the service are not failures.
+		if err := r.fn(ctx); err != nil && ctx.Err() == nil {
+			done <- err
+		}
+		close(done)
+	}()
+
+	return nil
+}
+
+// Stop cancels the context of the function and waits for it to return.
+func (r *Runner) Stop() error {
+	r.mu.Lock()
+	cancel, exited := r.cancel, r.exited
+	r.cancel = nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	<-exited
+	return nil
+}
+
+// Done returns a channel receiving the error returned by the function, or closed when the
+// function returned without an error.
+func (r *Runner) Done() <-chan error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.done
+}
@@ -0,0 +1,5 @@
+// Package services provides ready-made services for the ServiceManager: an HTTP server with
+// graceful shutdown, a scheduled job runner, a generic goroutine runner and an adapter for
+// Temporal workers. All of them can be added with ServiceManager.Add. Starting one of them
+// while it is already running returns manager.ErrServiceStarted.
+package services
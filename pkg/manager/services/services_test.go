@@ -0,0 +1,179 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flowshot-io/x/pkg/logger"
+	"github.com/flowshot-io/x/pkg/manager"
+	"github.com/flowshot-io/x/pkg/manager/services"
+)
+
+func TestHTTPServer(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	server := services.NewHTTPServer("127.0.0.1:0", handler, services.WithShutdownTimeout(time.Second))
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+
+	if err := server.Start(); !errors.Is(err, manager.ErrServiceStarted) {
+		t.Errorf("Expected ErrServiceStarted, got %v", err)
+	}
+
+	res, err := http.Get("http://" + server.Addr())
+	if err != nil {
+		t.Fatalf("Failed to request server: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("Expected body ok, got %q", body)
+	}
+
+	done := server.Done()
+	if err := server.Stop(); err != nil {
+		t.Fatalf("Failed to stop server: %v", err)
+	}
+
+	if err, ok := <-done; ok {
+		t.Errorf("Expected Done to be closed after shutdown, got %v", err)
+	}
+
+	// The server can be started again after it was stopped.
+	if err := server.Start(); err != nil {
+		t.Fatalf("Failed to restart server: %v", err)
+	}
+	server.Stop()
+}
+
+func TestJob(t *testing.T) {
+	t.Run("Runs On Schedule", func(t *testing.T) {
+		var runs atomic.Int32
+		job := services.NewJob(services.Every(time.Millisecond), func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}, services.WithJitter(time.Millisecond), services.WithRunImmediately())
+
+		if err := job.Start(); err != nil {
+			t.Fatalf("Failed to start job: %v", err)
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for runs.Load() < 3 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := job.Stop(); err != nil {
+			t.Fatalf("Failed to stop job: %v", err)
+		}
+
+		if runs.Load() < 3 {
+			t.Errorf("Expected job to run at least 3 times, ran %d times", runs.Load())
+		}
+	})
+
+	t.Run("Error Ends Job", func(t *testing.T) {
+		errJob := errors.New("job failed")
+		job := services.NewJob(services.Every(time.Millisecond), func(ctx context.Context) error {
+			return errJob
+		})
+		job.Start()
+		defer job.Stop()
+
+		select {
+		case err := <-job.Done():
+			if !errors.Is(err, errJob) {
+				t.Errorf("Expected job error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected job to end")
+		}
+	})
+
+	t.Run("Error Handler", func(t *testing.T) {
+		var failures atomic.Int32
+		job := services.NewJob(services.Every(time.Millisecond), func(ctx context.Context) error {
+			return errors.New("job failed")
+		}, services.WithErrorHandler(func(err error) {
+			failures.Add(1)
+		}))
+		job.Start()
+
+		deadline := time.Now().Add(time.Second)
+		for failures.Load() < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		job.Stop()
+
+		if failures.Load() < 2 {
+			t.Errorf("Expected job to keep running after errors")
+		}
+	})
+}
+
+func TestRunnerWithManager(t *testing.T) {
+	var attempts atomic.Int32
+	runner := services.NewRunner(func(ctx context.Context) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("first attempt failed")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	serviceManager := manager.New(&manager.Options{Logger: logger.NoOp()})
+	serviceManager.Add("runner", runner, manager.WithRestartPolicy(manager.RestartPolicy{
+		Mode:    manager.RestartOnFailure,
+		Backoff: time.Millisecond,
+	}))
+
+	if err := serviceManager.Start(); err != nil {
+		t.Fatalf("Failed to start services: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for attempts.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if attempts.Load() != 2 {
+		t.Errorf("Expected runner to be restarted once, ran %d times", attempts.Load())
+	}
+
+	if err := serviceManager.Stop(); err != nil {
+		t.Fatalf("Failed to stop services: %v", err)
+	}
+}
+
+type fakeWorker struct {
+	started, stopped bool
+}
+
+func (w *fakeWorker) Start() error {
+	w.started = true
+	return nil
+}
+
+func (w *fakeWorker) Stop() {
+	w.stopped = true
+}
+
+func TestTemporalWorker(t *testing.T) {
+	w := &fakeWorker{}
+	worker := services.NewTemporalWorker(w)
+
+	worker.Start()
+	worker.Stop()
+
+	if !w.started || !w.stopped {
+		t.Errorf("Expected worker to be started and stopped")
+	}
+}
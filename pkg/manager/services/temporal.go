@@ -0,0 +1,29 @@
+package services
+
+// Worker is the part of a Temporal worker used to run it as a service.
+// It is implemented by worker.Worker of the Temporal Go SDK.
+type Worker interface {
+	Start() error
+	Stop()
+}
+
+// TemporalWorker runs a Temporal worker as a service.
+type TemporalWorker struct {
+	worker Worker
+}
+
+// NewTemporalWorker creates a service running the worker.
+func NewTemporalWorker(worker Worker) *TemporalWorker {
+	return &TemporalWorker{worker: worker}
+}
+
+// Start starts polling the task queue of the worker.
+func (t *TemporalWorker) Start() error {
+	return t.worker.Start()
+}
+
+// Stop stops the worker, waiting for the tasks in progress to complete.
+func (t *TemporalWorker) Stop() error {
+	t.worker.Stop()
+	return nil
+}
@@ -0,0 +1,218 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultEventBuffer is the number of events buffered for a subscriber by default.
+const DefaultEventBuffer = 64
+
+// State defines the lifecycle state of a service.
+type State int
+
+const (
+	// StateNew is the state of a service which has not been started yet.
+	StateNew State = iota
+	// StateStarting is the state of a service whose Start is in progress.
+	StateStarting
+	// StateRunning is the state of a service which started successfully.
+	StateRunning
+	// StateStopping is the state of a service whose Stop is in progress.
+	StateStopping
+	// StateStopped is the state of a service which stopped or exited cleanly.
+	StateStopped
+	// StateFailed is the state of a service which failed to start or stop, or exited with an error.
+	StateFailed
+	// StateDraining is the state of a service finishing its work in flight before it is stopped.
+	StateDraining
+)
+
+var stateNames = map[State]string{
+	StateNew:      "new",
+	StateStarting: "starting",
+	StateRunning:  "running",
+	StateStopping: "stopping",
+	StateStopped:  "stopped",
+	StateFailed:   "failed",
+	StateDraining: "draining",
+}
+
+func (s State) String() string {
+	if name, ok := stateNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// MarshalText encodes the state as its name.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+type (
+	// ServiceStatus is a snapshot of the lifecycle of a service.
+	// StartedAt is the time the service last entered StateRunning, and Error is the last
+	// error the service reported. Children holds the status of the services of a nested
+	// ServiceManager.
+	ServiceStatus struct {
+		Name      ServiceName     `json:"name"`
+		Phase     string          `json:"phase"`
+		State     State           `json:"state"`
+		Since     time.Time       `json:"since"`
+		StartedAt time.Time       `json:"startedAt,omitempty"`
+		Restarts  int             `json:"restarts"`
+		Error     string          `json:"error,omitempty"`
+		Children  []ServiceStatus `json:"children,omitempty"`
+	}
+
+	// Event describes a lifecycle transition of a service.
+	Event struct {
+		Service ServiceName
+		From    State
+		To      State
+		Err     error
+		Time    time.Time
+	}
+
+	// serviceStatus holds the lifecycle state of a service.
+	serviceStatus struct {
+		mu        sync.Mutex
+		state     State
+		since     time.Time
+		startedAt time.Time
+		restarts  int
+		lastErr   error
+	}
+
+	// eventBus fans lifecycle events out to subscribers.
+	eventBus struct {
+		mu          sync.Mutex
+		nextID      int
+		subscribers map[int]chan Event
+	}
+)
+
+// Status returns a snapshot of the lifecycle state of all services, ordered by name.
+func (sm *ServiceManager) Status() []ServiceStatus {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	names := make([]ServiceName, 0, len(sm.services))
+	for name := range sm.services {
+		names = append(names, name)
+	}
+	sortServiceNames(names)
+
+	statuses := make([]ServiceStatus, 0, len(names))
+	for _, name := range names {
+		entry := sm.services[name]
+		status := entry.snapshot()
+		if reporter, ok := underlying(entry.service).(statusReporter); ok {
+			status.Children = reporter.Status()
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// Subscribe returns a channel receiving lifecycle events of all services and a function
+// which cancels the subscription and closes the channel. Events are never allowed to
+// block the manager: when the buffer of a subscriber is full, further events are dropped
+// for that subscriber until it catches up. A buffer of 0 uses DefaultEventBuffer.
+// Events of the services of a nested ServiceManager are included, naming the services by
+// their path, e.g. "subsystem/database".
+func (sm *ServiceManager) Subscribe(buffer int) (<-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+
+	ch := make(chan Event, buffer)
+
+	sm.events.mu.Lock()
+	id := sm.events.nextID
+	sm.events.nextID++
+	sm.events.subscribers[id] = ch
+	sm.events.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			sm.events.mu.Lock()
+			defer sm.events.mu.Unlock()
+
+			delete(sm.events.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+// transition moves a service to a new lifecycle state and publishes the event.
+func (sm *ServiceManager) transition(entry *serviceEntry, to State, err error) {
+	now := sm.clock.Now()
+
+	entry.status.mu.Lock()
+	from := entry.status.state
+	entry.status.state = to
+	entry.status.since = now
+	if to == StateRunning {
+		entry.status.startedAt = now
+	}
+	if err != nil {
+		entry.status.lastErr = err
+	}
+	entry.status.mu.Unlock()
+
+	sm.instrumentation.ObserveTransition(entry.name, from, to)
+	sm.events.publish(Event{
+		Service: entry.name,
+		From:    from,
+		To:      to,
+		Err:     err,
+		Time:    now,
+	})
+}
+
+// snapshot returns the current status of the service.
+func (e *serviceEntry) snapshot() ServiceStatus {
+	e.status.mu.Lock()
+	defer e.status.mu.Unlock()
+
+	status := ServiceStatus{
+		Name:      e.name,
+		Phase:     e.phase.Name,
+		State:     e.status.state,
+		Since:     e.status.since,
+		StartedAt: e.status.startedAt,
+		Restarts:  e.status.restarts,
+	}
+
+	if e.status.lastErr != nil {
+		status.Error = e.status.lastErr.Error()
+	}
+
+	return status
+}
+
+// addRestart records a restart of the service by its supervisor.
+func (e *serviceEntry) addRestart() {
+	e.status.mu.Lock()
+	defer e.status.mu.Unlock()
+
+	e.status.restarts++
+}
+
+func (b *eventBus) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
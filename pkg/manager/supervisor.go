@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultRestartBackoff is the delay before the first restart of a service by default.
+const DefaultRestartBackoff = time.Second
+
+type (
+	// Waitable is implemented by services which keep running in the background after Start
+	// returns. The channel returned by Done receives the error that ended the service, or is
+	// closed when the service exits without an error. Done must return a new channel after
+	// the service has been restarted.
+	Waitable interface {
+		Done() <-chan error
+	}
+
+	// RestartMode defines when a service which exited on its own is restarted.
+	RestartMode int
+
+	// RestartPolicy defines how the manager supervises a Waitable service.
+	// MaxRestarts limits the number of restarts while the manager is running (0 means no limit).
+	// Backoff sets the delay before the first restart, doubling with every further attempt
+	// up to MaxBackoff (defaults to DefaultRestartBackoff, 0 MaxBackoff means no limit).
+	// A service which failed and is not restarted escalates: the manager shuts down all
+	// services, unless IgnoreFailure is set.
+	RestartPolicy struct {
+		Mode          RestartMode
+		MaxRestarts   int
+		Backoff       time.Duration
+		MaxBackoff    time.Duration
+		IgnoreFailure bool
+	}
+)
+
+const (
+	// RestartNever leaves a service stopped once it exited.
+	RestartNever RestartMode = iota
+	// RestartOnFailure restarts a service which exited with an error.
+	RestartOnFailure
+	// RestartAlways restarts a service whenever it exited.
+	RestartAlways
+)
+
+// WithRestartPolicy sets how the service is supervised once it has started.
+func WithRestartPolicy(policy RestartPolicy) ServiceOption {
+	return func(e *serviceEntry) {
+		e.restartPolicy = policy
+	}
+}
+
+// supervise waits for a running service to exit and restarts it according to its restart
+// policy, escalating failures it does not recover from, until the manager stops it.
+func (sm *ServiceManager) supervise(entry *serviceEntry, stopping <-chan struct{}) {
+	policy := entry.restartPolicy
+	restarts := 0
+
+	for {
+		w, ok := underlying(entry.service).(Waitable)
+		if !ok {
+			return
+		}
+
+		var err error
+		select {
+		case exitErr, ok := <-w.Done():
+			if ok {
+				err = exitErr
+			}
+		case <-stopping:
+			return
+		}
+
+		// Keep restarting while the restarted service fails to start.
+		for {
+			if isClosed(stopping) {
+				return
+			}
+
+			if err != nil {
+				sm.transition(entry, StateFailed, err)
+				sm.logger.Error("Service failed", entry.logFields(errorFields(err)))
+			} else {
+				sm.transition(entry, StateStopped, nil)
+				sm.logger.Info("Service exited", entry.logFields())
+			}
+
+			restart := policy.Mode == RestartAlways || (policy.Mode == RestartOnFailure && err != nil)
+			if !restart || (policy.MaxRestarts > 0 && restarts >= policy.MaxRestarts) {
+				if err != nil && !policy.IgnoreFailure {
+					sm.escalate(fmt.Errorf("service %s failed: %w", entry.name, err))
+				}
+				return
+			}
+
+			restarts++
+			entry.addRestart()
+			sm.instrumentation.ObserveRestart(entry.name)
+			delay := restartDelay(policy, restarts)
+			sm.logger.Warn("Restarting service", entry.logFields(map[string]interface{}{
+				"attempt": restarts,
+				"delay":   delay.String(),
+			}))
+
+			timer := sm.clock.NewTimer(delay)
+			select {
+			case <-timer.C():
+			case <-stopping:
+				timer.Stop()
+				return
+			}
+
+			err = sm.restart(entry, stopping)
+			if isClosed(stopping) {
+				return
+			}
+			if err == nil {
+				break
+			}
+		}
+
+		sm.logger.Info("Service restarted successfully", entry.logFields())
+	}
+}
+
+// restart stops what is left of an exited service and starts it again, unless the manager
+// stopped supervising the service in the meantime.
+func (sm *ServiceManager) restart(entry *serviceEntry, stopping <-chan struct{}) error {
+	entry.lifecycle.Lock()
+	defer entry.lifecycle.Unlock()
+
+	if isClosed(stopping) {
+		return nil
+	}
+
+	// The service already exited; Stop only releases what it left behind.
+	ctx, end := sm.instrumentation.StartOperation(context.Background(), entry.name, OpStop)
+	end(callWithTimeout(ctx, entry.name, OpStop, entry.stopTimeout, entry.service.Stop))
+
+	sm.transition(entry, StateStarting, nil)
+	ctx, end = sm.instrumentation.StartOperation(context.Background(), entry.name, OpStart)
+	err := callWithTimeout(ctx, entry.name, OpStart, entry.startTimeout, entry.service.Start)
+	end(err)
+	if err != nil {
+		return err
+	}
+
+	sm.transition(entry, StateRunning, nil)
+	return nil
+}
+
+// escalate reports a failure which the service's restart policy does not recover from.
+// Run and the parent of a nested manager handle the failure; any other manager stops itself.
+func (sm *ServiceManager) escalate(err error) {
+	select {
+	case sm.failed <- err:
+	default:
+	}
+
+	sm.opMutex.Lock()
+	handled := sm.running || sm.supervised
+	sm.opMutex.Unlock()
+
+	if !handled {
+		sm.logger.Error("Stopping all services after service failure", map[string]interface{}{
+			"error": err.Error(),
+		})
+		go sm.Stop()
+	}
+}
+
+// restartDelay returns the backoff before the given restart attempt.
+func restartDelay(policy RestartPolicy, attempt int) time.Duration {
+	delay := policy.Backoff
+	if delay <= 0 {
+		delay = DefaultRestartBackoff
+	}
+
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if policy.MaxBackoff > 0 && delay >= policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+	}
+
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+
+	return delay
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -2,6 +2,8 @@ package temporalactivities
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/flowshot-io/x/pkg/artifact"
 	"github.com/flowshot-io/x/pkg/artifactservice"
@@ -9,6 +11,7 @@ import (
 
 type ArtifactActivities struct {
 	artifactClient artifactservice.ArtifactServiceClient
+	scopes         *artifactservice.ScopeIndex
 }
 
 // NewArtifactActivities returns a new instance of an ArtifactActivities.
@@ -18,6 +21,30 @@ func NewArtifactActivities(artifactClient artifactservice.ArtifactServiceClient)
 	}
 }
 
+// NewScopedArtifactActivities returns a new instance of an ArtifactActivities which can tag
+// artifacts with their owning workflow and clean them up once the workflow has finished.
+//
+// Workflows release their scratch artifacts by running CleanupScopedArtifacts from a
+// disconnected context when they complete, for example:
+//
+//	defer func() {
+//		ctx, cancel := workflow.NewDisconnectedContext(ctx)
+//		defer cancel()
+//
+//		ctx = workflow.WithActivityOptions(ctx, workflow.ActivityOptions{StartToCloseTimeout: time.Minute})
+//		workflow.ExecuteActivity(ctx, a.CleanupScopedArtifacts, workflow.GetInfo(ctx).WorkflowExecution.ID).Get(ctx, nil)
+//	}()
+//
+// SweepScopedArtifacts should be scheduled periodically to retry cleanups that failed. To also
+// catch workflows that never ran their cleanup, such as those that were terminated, create the
+// ScopeIndex with artifactservice.WithCompletionFunc reporting the close time of the workflow.
+func NewScopedArtifactActivities(artifactClient artifactservice.ArtifactServiceClient, scopes *artifactservice.ScopeIndex) *ArtifactActivities {
+	return &ArtifactActivities{
+		artifactClient: artifactClient,
+		scopes:         scopes,
+	}
+}
+
 // PullArtifact downloads the specified artifact from the artifact service to a local directory.
 func (a *ArtifactActivities) PullArtifact(ctx context.Context, artifactName string, destinationPath string) error {
 	artifact, err := a.artifactClient.DownloadArtifact(ctx, artifactName)
@@ -47,3 +74,48 @@ func (a *ArtifactActivities) PushArtifact(ctx context.Context, artifactName stri
 
 	return nil
 }
+
+// PushScopedArtifact creates an artifact from the specified files, tags it as owned by the
+// workflow and uploads it to the artifact service.
+func (a *ArtifactActivities) PushScopedArtifact(ctx context.Context, workflowID string, artifactName string, files []string) error {
+	if a.scopes == nil {
+		return fmt.Errorf("scoped artifacts are not enabled")
+	}
+
+	err := a.scopes.Tag(ctx, workflowID, artifactName)
+	if err != nil {
+		return err
+	}
+
+	return a.PushArtifact(ctx, artifactName, files)
+}
+
+// CleanupScopedArtifacts deletes all artifacts owned by the workflow. The workflow is marked
+// as completed first, so SweepScopedArtifacts finishes the cleanup if it fails.
+func (a *ArtifactActivities) CleanupScopedArtifacts(ctx context.Context, workflowID string) error {
+	if a.scopes == nil {
+		return fmt.Errorf("scoped artifacts are not enabled")
+	}
+
+	err := a.scopes.Complete(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.scopes.Release(ctx, a.artifactClient, workflowID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SweepScopedArtifacts deletes scoped artifacts of any workflow that completed longer than
+// the grace period ago and returns the number of artifacts deleted.
+func (a *ArtifactActivities) SweepScopedArtifacts(ctx context.Context, gracePeriod time.Duration) (int, error) {
+	if a.scopes == nil {
+		return 0, fmt.Errorf("scoped artifacts are not enabled")
+	}
+
+	return a.scopes.Sweep(ctx, a.artifactClient, gracePeriod)
+}